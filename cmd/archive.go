@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/Nadim147c/yankd/internal/importer"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(exportCommand)
+	Command.AddCommand(importCommand)
+	fset := importCommand.Flags()
+	fset.String(
+		"from", "yankd",
+		"clipboard manager the history is from (yankd, cliphist, clipman)",
+	)
+}
+
+var exportCommand = &cobra.Command{
+	Use:   "export <path>",
+	Short: "Export clipboard history into an archive",
+	Long: `Export clipboard history into a tar archive containing clips.ndjson, a JSON
+record of an item per line, and the blob files in blobs/.
+
+The archive is written to stdout if path is -, gzip compressed if path ends
+with .gz or .tgz, and into a directory if path is a directory or ends with /.
+Encrypted history is exported in plain text.`,
+	Example: `
+  # Back up the history
+  yankd export yankd.tar.gz
+
+  # Copy the history to another machine
+  yankd export - | ssh host yankd import -
+  `,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := args[0]
+		ctx := cmd.Context()
+
+		var (
+			n   int
+			err error
+		)
+		switch {
+		case path == "-":
+			n, err = exportArchive(cmd, os.Stdout, false)
+		case isDir(path) || strings.HasSuffix(path, "/"):
+			n, err = db.ExportDir(ctx, path)
+		default:
+			n, err = exportFile(cmd, path)
+		}
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Clipboard history exported", "exported-items", n)
+		return db.Close()
+	},
+}
+
+// exportFile writes the archive into the file at path.
+func exportFile(cmd *cobra.Command, path string) (int, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+
+	compress := strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz")
+	n, err := exportArchive(cmd, f, compress)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// exportArchive writes the tar archive into w.
+func exportArchive(cmd *cobra.Command, w io.Writer, compress bool) (int, error) {
+	if !compress {
+		return db.Export(cmd.Context(), w)
+	}
+
+	gw := gzip.NewWriter(w)
+	n, err := db.Export(cmd.Context(), gw)
+	if err != nil {
+		return n, err
+	}
+	return n, gw.Close()
+}
+
+var importCommand = &cobra.Command{
+	Use:   "import [path]",
+	Short: "Import clipboard history from an archive or another manager",
+	Long: `Import clipboard history from an archive written by yankd export. The
+archive is read from stdin if path is -, and gzip compressed archives are
+detected.
+
+With --from, the history of another clipboard manager is imported instead:
+
+  cliphist   path is the cliphist database (default
+             XDG_CACHE_HOME/cliphist/db)
+  clipman    path is the clipman history file (default
+             XDG_DATA_HOME/clipman.json)
+
+The MIME type of their items is detected from the content. They don't record
+when an item is copied, so the items are imported as copied just now in their
+original order.
+
+Items already in history are not duplicated: the later last use of both is
+kept and the item is pinned if either is pinned. Times of the imported items
+are kept.`,
+	Example: `
+  # Restore a backup
+  yankd import yankd.tar.gz
+
+  # Migrate from cliphist
+  yankd import --from cliphist
+
+  # Migrate from clipman
+  yankd import --from clipman ~/.local/share/clipman.json
+  `,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		path := ""
+		if len(args) != 0 {
+			path = args[0]
+		}
+		from, err := cmd.Flags().GetString("from")
+		if err != nil {
+			return err
+		}
+
+		var stats db.ImportStats
+		switch from {
+		case "cliphist":
+			if path == "" {
+				path = importer.CliphistDatabase()
+			}
+			stats, err = db.ImportClips(ctx, importer.Cliphist(path))
+		case "clipman":
+			if path == "" {
+				path = importer.ClipmanHistory()
+			}
+			stats, err = db.ImportClips(ctx, importer.Clipman(path))
+		case "yankd":
+			if path == "" {
+				return errors.New("path of the archive is required")
+			}
+			stats, err = importYankd(cmd, path)
+		default:
+			return fmt.Errorf("invalid clipboard manager: %q", from)
+		}
+		if err != nil {
+			return err
+		}
+
+		slog.Info(
+			"Clipboard history imported",
+			"imported-items", stats.Imported,
+			"duplicate-items", stats.Duplicates,
+		)
+		return db.Close()
+	},
+}
+
+// importYankd reads the archive at path written by yankd export.
+func importYankd(cmd *cobra.Command, path string) (db.ImportStats, error) {
+	switch {
+	case path == "-":
+		return importArchive(cmd, os.Stdin)
+	case isDir(path):
+		return db.ImportDir(cmd.Context(), path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return db.ImportStats{}, err
+	}
+	defer f.Close()
+	return importArchive(cmd, f)
+}
+
+// gzipMagic is the header of gzip compressed data
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// importArchive reads the tar archive from r, which may be gzip compressed.
+func importArchive(cmd *cobra.Command, r io.Reader) (db.ImportStats, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err != nil ||
+		!bytes.Equal(magic, gzipMagic) {
+		return db.Import(cmd.Context(), br)
+	}
+
+	gr, err := gzip.NewReader(br)
+	if err != nil {
+		return db.ImportStats{}, err
+	}
+	defer gr.Close()
+	return db.Import(cmd.Context(), gr)
+}
+
+// isDir reports whether path is an existing directory.
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
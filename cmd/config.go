@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Nadim147c/yankd/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Command.AddCommand(configCommand)
+	configCommand.AddCommand(configShowCommand)
+	configCommand.AddCommand(configCheckCommand)
+	configShowCommand.Flags().Bool("json", false, "print the config as JSON")
+}
+
+var configCommand = &cobra.Command{
+	Use:   "config",
+	Short: "Show and check the configuration",
+}
+
+var configShowCommand = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Long: `Print the value of every config key with its source, the first of:
+
+  flag      given on the command line
+  env       set by the YANKD_ environment variable
+  config    set by the config file
+  default   default of the flag`,
+	Example: `
+  # Show where the database location comes from
+  yankd config show | grep database
+
+  # Show the configuration with a different config file
+  yankd --config ./config.toml config show
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		asJSON, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+
+		settings := effectiveConfig()
+		if asJSON {
+			return json.NewEncoder(os.Stdout).Encode(settings)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tSOURCE\tVALUE")
+		for _, s := range settings {
+			source := s.Source
+			if s.From != "" {
+				source += " " + s.From
+			}
+			value := settingValue(s.Value)
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, source, value)
+		}
+		return w.Flush()
+	},
+}
+
+var configCheckCommand = &cobra.Command{
+	Use:   "check [path]",
+	Short: "Validate a config file",
+	Long: `Validate a config file against the schema of the config keys. Reports
+syntax errors, unknown keys and invalid values. The loaded config file is
+checked if path is not given.`,
+	Example: `
+  # Check the config file in use
+  yankd config check
+
+  # Check a config file before installing it
+  yankd config check ./config.json
+  `,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		path := viper.ConfigFileUsed()
+		if len(args) != 0 {
+			path = args[0]
+		}
+		if path == "" {
+			return errors.New("no config file found")
+		}
+
+		problems := config.Check(path)
+		if len(problems) == 0 {
+			fmt.Printf("%s: ok\n", path)
+			return nil
+		}
+
+		for _, problem := range problems {
+			fmt.Printf("%s: %v\n", path, problem)
+		}
+		return fmt.Errorf("config file has %d problem(s)", len(problems))
+	},
+}
+
+// setting is the value of a config key and where it comes from
+type setting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+	// From is the flag, environment variable or config file setting the value
+	From string `json:"from,omitempty"`
+}
+
+// effectiveConfig returns the settings of every config key.
+func effectiveConfig() []setting {
+	var settings []setting
+	for _, key := range config.Keys() {
+		env := config.Env(key)
+		flag := keyFlag(key)
+
+		s := setting{Key: key, Value: viper.Get(key)}
+		_, inEnv := os.LookupEnv(env)
+		switch {
+		case flag != nil && flag.Changed:
+			s.Source, s.From = "flag", "--"+key
+		case inEnv:
+			s.Source, s.From = "env", env
+		case viper.InConfig(key):
+			s.Source, s.From = "config", viper.ConfigFileUsed()
+		default:
+			s.Source = "default"
+			if s.Value == nil && flag != nil {
+				s.Value = flag.DefValue
+			}
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// keyFlag returns the flag of the config key, a persistent flag of the root
+// command or a flag of the command named by the section of the key.
+func keyFlag(key string) *pflag.Flag {
+	section := config.Section(key)
+	if section == "" {
+		return Command.PersistentFlags().Lookup(key)
+	}
+
+	for _, sub := range Command.Commands() {
+		if sub.Name() == section {
+			return sub.Flags().Lookup(strings.TrimPrefix(key, section+"."))
+		}
+	}
+	return nil
+}
+
+// settingValue formats the value of a setting for the table.
+func settingValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return `""`
+		}
+		return v
+	case []string:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
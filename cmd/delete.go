@@ -6,7 +6,6 @@ import (
 	"github.com/Nadim147c/yankd/internal/db"
 	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 func init() {
@@ -30,14 +29,21 @@ var deleteCommand = &cobra.Command{
   yankd search --limit 10000 "BEGIN KEY" | awk '{ print $1 }' | xargs yankd delete
   `,
 	Args: cobra.MinimumNArgs(1),
-	PreRunE: func(cmd *cobra.Command, _ []string) error {
-		return viper.BindPFlags(cmd.Flags())
-	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ids, err := cast.ToUintSliceE(args)
 		if err != nil {
 			return err
 		}
+		if c := dialDaemon(); c != nil {
+			defer c.Close()
+			n, err := c.Delete(cmd.Context(), ids)
+			if err != nil {
+				return err
+			}
+			slog.Info("Clipboard history deleted", "deleted-items", n)
+			return nil
+		}
+
 		n, err := db.Delete(cmd.Context(), ids)
 		if err != nil {
 			return err
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(fsckCommand)
+	fset := fsckCommand.Flags()
+	fset.BoolP("repair", "r", false, "repair the problems found")
+}
+
+var fsckCommand = &cobra.Command{
+	Use:   "fsck",
+	Short: "Check and repair the blob store",
+	Long: `Check that every blob file referenced by the clipboard history exists and
+every file in the blob directory is referenced.
+
+With --repair, orphaned files are removed, blobs found under a different path
+are relinked, and items or representations with a missing blob are deleted.`,
+	Example: `
+  # Report problems in the blob store
+  yankd fsck
+
+  # Repair the problems
+  yankd fsck --repair
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		repair, err := cmd.Flags().GetBool("repair")
+		if err != nil {
+			return err
+		}
+		issues, err := db.Fsck(cmd.Context(), repair)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		for _, issue := range issues {
+			fmt.Printf("%s\t%d\t%s\n", issue.Problem, issue.ClipID, issue.Path)
+		}
+
+		if len(issues) != 0 && !repair {
+			return fmt.Errorf("found %d problems, run with --repair", len(issues))
+		}
+		slog.Info("Blob store checked", "problems", len(issues))
+		return nil
+	},
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/charmbracelet/x/term"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Command.AddCommand(lockCommand)
+	Command.AddCommand(unlockCommand)
+}
+
+var unlockCommand = &cobra.Command{
+	Use:   "unlock",
+	Short: "Unlock the encrypted clipboard history",
+	Long: `Unlock the encrypted clipboard history with the key file or the passphrase.
+The passphrase is read from YANKD_PASSPHRASE or asked on the terminal.
+
+The key is kept in the runtime directory until yankd lock or logout, so the
+watcher and other commands can read and record the history without it.
+
+Unlocking history which isn't encrypted yet enables encryption with the given
+key and encrypts the existing history. The search index is kept in memory
+from then on, since the on-disk index would contain the plain text.`,
+	Example: `
+  # Unlock with a passphrase asked on the terminal
+  yankd unlock
+
+  # Unlock with a key file
+  yankd unlock --key-file ~/.config/yankd/key
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if viper.GetString("key-file") == "" &&
+			viper.GetString("passphrase") == "" {
+			pass, err := askPassphrase()
+			if err != nil {
+				return err
+			}
+			viper.Set("passphrase", pass)
+		}
+
+		if err := db.Unlock(cmd.Context()); err != nil {
+			return err
+		}
+		return db.Close()
+	},
+}
+
+var lockCommand = &cobra.Command{
+	Use:   "lock",
+	Short: "Lock the encrypted clipboard history",
+	Long: `Lock the encrypted clipboard history by removing the key kept by yankd
+unlock. The watcher stops recording until the history is unlocked again,
+unless it is started with a key file or passphrase.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return db.Lock()
+	},
+}
+
+// askPassphrase reads the passphrase from the terminal. A new passphrase is
+// asked twice.
+func askPassphrase() (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", db.ErrNoKey
+	}
+
+	encrypted, err := db.Encrypted()
+	if err != nil {
+		return "", err
+	}
+
+	prompts := []string{"Passphrase: "}
+	if !encrypted {
+		prompts = []string{"New passphrase: ", "Repeat passphrase: "}
+	}
+
+	var answers []string
+	for _, prompt := range prompts {
+		fmt.Fprint(os.Stderr, prompt)
+		pass, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		answers = append(answers, string(pass))
+	}
+
+	if answers[0] == "" {
+		return "", errors.New("passphrase can not be empty")
+	}
+	if len(answers) == 2 && answers[0] != answers[1] {
+		return "", errors.New("passphrases don't match")
+	}
+	return answers[0], nil
+}
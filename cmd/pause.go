@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/daemon"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(pauseCommand)
+	Command.AddCommand(resumeCommand)
+	Command.AddCommand(statusCommand)
+	pauseCommand.Flags().Duration(
+		"for", 0,
+		"resume recording after this long (0 pauses until resume)",
+	)
+	statusCommand.Flags().StringP(
+		"format", "f", "simple",
+		"output format (simple, json, or Go template string)",
+	)
+}
+
+var pauseCommand = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause recording clipboard history",
+	Long: `Pause recording clipboard history, e.g. before using a password manager or
+sharing the screen. Items copied while paused are dropped by yankd watch.`,
+	Example: `
+  # Pause recording until yankd resume
+  yankd pause
+
+  # Pause recording for 5 minutes
+  yankd pause --for 5m
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		d, err := cmd.Flags().GetDuration("for")
+		if err != nil {
+			return err
+		}
+
+		c, err := daemon.Dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to yankd watch: %w", err)
+		}
+		defer c.Close()
+
+		status, err := c.Pause(cmd.Context(), d)
+		if err != nil {
+			return err
+		}
+		slog.Info("Recording paused", "until", status.Until)
+		return nil
+	},
+}
+
+var resumeCommand = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume recording clipboard history",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		c, err := daemon.Dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to yankd watch: %w", err)
+		}
+		defer c.Close()
+
+		if _, err := c.Resume(cmd.Context()); err != nil {
+			return err
+		}
+		slog.Info("Recording resumed")
+		return nil
+	},
+}
+
+var statusCommand = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether clipboard history is recorded",
+	Long: `Show whether yankd watch is running and recording clipboard history. The
+template format is given the running, paused and until fields of the JSON
+format.`,
+	Example: `
+  # Show the state in a status bar
+  yankd status --format '{{if .Paused}}paused{{else}}recording{{end}}'
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+
+		// not running is a state too, e.g. for status bars
+		var status daemon.Status
+		c, err := daemon.Dial()
+		if err != nil {
+			slog.Debug("daemon is not available", "error", err)
+		} else {
+			defer c.Close()
+			status, err = c.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+		}
+
+		switch strings.ToLower(format) {
+		case "simple":
+			fmt.Println(simpleStatus(status))
+			return nil
+		case "json":
+			return json.NewEncoder(os.Stdout).Encode(status)
+		default:
+			tmpl, err := template.New("status").Funcs(templateFunc).Parse(format)
+			if err != nil {
+				return fmt.Errorf("invalid template: %w", err)
+			}
+			return tmpl.Execute(os.Stdout, status)
+		}
+	},
+}
+
+// simpleStatus describes the recording state.
+func simpleStatus(status daemon.Status) string {
+	switch {
+	case !status.Running:
+		return "not running"
+	case !status.Paused:
+		return "recording"
+	case status.Until.IsZero():
+		return "paused"
+	default:
+		return "paused until " + status.Until.Local().Format(time.TimeOnly)
+	}
+}
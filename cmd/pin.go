@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"log/slog"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(pinCommand)
+	Command.AddCommand(unpinCommand)
+}
+
+var pinCommand = &cobra.Command{
+	Use:   "pin ...ids",
+	Short: "Pin items to keep them from being pruned",
+	Example: `
+  # Pin item with ID 42
+  yankd pin 42
+  `,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pin(cmd, args, true)
+	},
+}
+
+var unpinCommand = &cobra.Command{
+	Use:   "unpin ...ids",
+	Short: "Unpin items",
+	Example: `
+  # Unpin item with ID 42
+  yankd unpin 42
+  `,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pin(cmd, args, false)
+	},
+}
+
+func pin(cmd *cobra.Command, args []string, pinned bool) error {
+	ids, err := cast.ToUintSliceE(args)
+	if err != nil {
+		return err
+	}
+	n, err := db.Pin(cmd.Context(), ids, pinned)
+	if err != nil {
+		return err
+	}
+	slog.Info("Clipboard history updated", "pinned", pinned, "updated-items", n)
+	return db.Close()
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Command.AddCommand(pruneCommand)
+	addRetentionFlags(pruneCommand)
+}
+
+var pruneCommand = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete items exceeding the retention limits",
+	Long: `Delete the oldest items exceeding the retention limits, by default the
+limits of the watch section of the config file. Pinned items are never pruned
+and don't count towards the limits.`,
+	Example: `
+  # Keep the latest 1000 items
+  yankd prune --max-items 1000
+
+  # Delete items older than 30 days
+  yankd prune --max-age 720h
+
+  # Keep at most 1GiB of images and other binary content
+  yankd prune --max-blob-size 1GiB
+  `,
+	Args:    cobra.NoArgs,
+	PreRunE: bindSection("watch"),
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		retention, err := retentionOptions()
+		if err != nil {
+			return err
+		}
+		if retention.IsZero() {
+			return errors.New("no retention limit is set")
+		}
+
+		ids, err := db.Prune(cmd.Context(), retention)
+		if err != nil {
+			return err
+		}
+		slog.Info("Clipboard history pruned", "deleted-items", len(ids))
+		return db.Close()
+	},
+}
+
+// addRetentionFlags adds the flags of the retention limits to cmd.
+func addRetentionFlags(cmd *cobra.Command) {
+	fset := cmd.Flags()
+	fset.Int(
+		"max-items", 0,
+		"keep at most this many unpinned items (0 is unlimited)",
+	)
+	fset.Duration(
+		"max-age", 0,
+		"delete unpinned items not used for this long (0 is unlimited)",
+	)
+	fset.String(
+		"max-blob-size", "0",
+		"keep at most this much blob data of unpinned items (0 is unlimited)",
+	)
+}
+
+// retentionOptions creates the retention limits from the flags.
+func retentionOptions() (db.Retention, error) {
+	retention := db.Retention{
+		MaxItems: viper.GetInt("watch.max-items"),
+		MaxAge:   viper.GetDuration("watch.max-age"),
+	}
+
+	size, err := humanize.ParseBytes(viper.GetString("watch.max-blob-size"))
+	if err != nil {
+		return retention, fmt.Errorf("invalid max blob size: %w", err)
+	}
+	retention.MaxBlobSize = int64(size)
+
+	if retention.MaxItems < 0 || retention.MaxAge < 0 {
+		return retention, errors.New("retention limits can not be negative")
+	}
+	return retention, nil
+}
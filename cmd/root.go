@@ -2,29 +2,47 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"syscall"
 	"time"
 
+	"github.com/Nadim147c/yankd/internal/config"
+	"github.com/Nadim147c/yankd/internal/daemon"
 	"github.com/charmbracelet/log"
 
 	"github.com/Nadim147c/fang"
 	"github.com/adrg/xdg"
 	"github.com/carapace-sh/carapace"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 func init() {
 	pfset := Command.PersistentFlags()
+	pfset.String(
+		"config", "",
+		"config file (default XDG_CONFIG_HOME/yankd/config.{json,toml,yaml})",
+	)
 	pfset.StringP("database", "d", "XDG_DATA_HOME/yankd", "set database location directory")
 	pfset.CountP("verbose", "v", "set log level")
 	pfset.BoolP("quiet", "q", false, "suppress all the logs")
+	pfset.String(
+		"fts-tokenizer", config.TokenizerUnicode,
+		"tokenizer of the search index (unicode61, trigram)",
+	)
+	pfset.String(
+		"key-file", "",
+		"file with the key to encrypt history (or set YANKD_PASSPHRASE)",
+	)
 
 	viper.SetEnvPrefix("yankd")
+	viper.SetEnvKeyReplacer(config.EnvKeyReplacer)
 	viper.AutomaticEnv()
 
 	carapace.Gen(Command)
@@ -35,7 +53,14 @@ var Command = &cobra.Command{
 	Use:   "yankd",
 	Short: "A wayland native clipboard manager",
 	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
-		viper.BindPFlags(cmd.Flags())
+		// persistent flags are the top level keys, the flags of commands are
+		// bound to their section by bindSection
+		if err := viper.BindPFlags(cmd.Root().PersistentFlags()); err != nil {
+			return err
+		}
+
+		// the config file may set the log level
+		configErr := config.Load()
 
 		level := log.WarnLevel - (log.Level(viper.GetInt("verbose") * 4))
 		if viper.GetBool("quiet") {
@@ -53,6 +78,14 @@ var Command = &cobra.Command{
 		viper.SetDefault("database", dbPath)
 
 		slog.Info("Logger is has been setup", "level", level)
+		// config check reports the problems of the config file itself
+		if configErr != nil && cmd != configCheckCommand {
+			slog.Error("failed to load config file", "error", configErr)
+			return configErr
+		}
+		if path := viper.ConfigFileUsed(); path != "" {
+			slog.Info("config file loaded", "path", path)
+		}
 
 		return nil
 	},
@@ -73,3 +106,31 @@ func Execute(version string) {
 		os.Exit(1)
 	}
 }
+
+// dialDaemon connects to the daemon. Returns nil if the daemon isn't running,
+// in which case the database is used directly.
+func dialDaemon() *daemon.Client {
+	c, err := daemon.Dial()
+	if err != nil {
+		slog.Debug("daemon is not available, using database", "error", err)
+		return nil
+	}
+	return c
+}
+
+// bindSection binds the flags of the command to the config keys of the section,
+// e.g. --primary of watch to watch.primary. Other flags only apply to the
+// invocation and are read from the command.
+func bindSection(section string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, _ []string) error {
+		keys := config.Keys()
+		var errs []error
+		cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+			key := section + "." + f.Name
+			if slices.Contains(keys, key) {
+				errs = append(errs, viper.BindPFlag(key, f))
+			}
+		})
+		return errors.Join(errs...)
+	}
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -18,16 +19,40 @@ func init() {
 	fset := searchCommand.Flags()
 	fset.BoolP("sync", "s", false, "synchronize database before search")
 	fset.IntP("limit", "n", 40, "number of items to display")
+	fset.StringP(
+		"selection", "S", "",
+		"only show items from selection (clipboard or primary)",
+	)
 	fset.StringP(
 		"format", "f", "simple",
 		"output format (simple, json, json-stream, or Go template string)",
 	)
+	fset.String(
+		"highlight", "",
+		"mark matches in snippets with START,END (default color on terminal)",
+	)
 }
 
+// ansiHighlight marks matches on terminal
+var ansiHighlight = [2]string{"\x1b[1;31m", "\x1b[0m"}
+
 var searchCommand = &cobra.Command{
 	Use:   "search <query>",
 	Short: "Search clipboard history",
-	Long:  "Search through clipboard history for items matching the query",
+	Long: `Search through clipboard history for items matching the query, the most
+recently used first.
+
+A query is a list of words, quoted phrases and filters, all of which must
+match. Any of them is negated with a leading -.
+
+  mime:PATTERN          mime type matches the glob pattern, e.g. image/*
+  before:TIME           last used before a date (2026-01-01) or a duration
+  after:TIME            ago (90m, 12h, 3d, 2w)
+  has:FIELD             has url, blob, text or metadata
+  id:N                  id is N, or compared as >N, >=N, <N, <=N, or N..M
+  selection:SELECTION   copied to clipboard or primary
+  seat:NAME             copied on the seat
+  is:pinned             is pinned`,
 	Example: `
   # Search for "password" in clipboard history
   yankd search password
@@ -35,29 +60,59 @@ var searchCommand = &cobra.Command{
   # Limit results to 10 items in JSON format
   yankd search password --limit 10 --format json
 
+  # Search for "password" in primary selection history
+  yankd search password --selection primary
+
+  # Search for images copied in the last 3 days
+  yankd search mime:image/* after:3d
+
+  # Search for an exact phrase, excluding html
+  yankd search '"hello world"' -mime:text/html
+
   # Sync database before searching
   yankd search password --sync
 
   # Use custom template
   yankd search password --format "{{.ID}}: {{.Text}}"
+
+  # Show the matched part of each item with matches in html bold tags
+  yankd search password --format '{{.Snippet}}{{"\n"}}' --highlight "<b>,</b>"
   `,
-	PreRunE: func(cmd *cobra.Command, _ []string) error {
-		viper.SetDefault("limit", 40)
-		return viper.BindPFlags(cmd.Flags())
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		viper.SetDefault("search.limit", 40)
+		return bindSection("search")(cmd, args)
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		query := strings.Join(args, " ")
 
-		sync := viper.GetBool("sync")
-		limit := viper.GetInt("limit")
+		sync := viper.GetBool("search.sync")
+		limit := viper.GetInt("search.limit")
+		selection := clipboard.Selection(viper.GetString("search.selection"))
+		switch selection {
+		case "", clipboard.SelectionClipboard, clipboard.SelectionPrimary:
+		default:
+			return fmt.Errorf("invalid selection: %q", selection)
+		}
 
-		clips, err := db.Search(cmd.Context(), query, limit, sync)
+		format := viper.GetString("search.format")
+		highlight, err := snippetHighlight(format)
 		if err != nil {
 			return err
 		}
-		defer db.Close()
 
-		format := viper.GetString("format")
+		clips, err := searchHistory(cmd.Context(), query, limit, sync, selection)
+		if err != nil {
+			return err
+		}
+
+		replacer := strings.NewReplacer(
+			db.SnippetStart, highlight[0],
+			db.SnippetEnd, highlight[1],
+		)
+		for i := range clips {
+			clips[i].Snippet = replacer.Replace(clips[i].Snippet)
+		}
+
 		switch strings.ToLower(format) {
 		case "simple":
 			return formatSimple(clips)
@@ -71,6 +126,47 @@ var searchCommand = &cobra.Command{
 	},
 }
 
+// searchHistory searches with the daemon if it is running, otherwise in the
+// database.
+func searchHistory(
+	ctx context.Context,
+	query string,
+	limit int,
+	sync bool,
+	selection clipboard.Selection,
+) ([]clipboard.Clip, error) {
+	if c := dialDaemon(); c != nil {
+		defer c.Close()
+		return c.Search(ctx, query, limit, sync, selection)
+	}
+
+	defer db.Close()
+	return db.Search(ctx, query, limit, sync, selection)
+}
+
+// snippetHighlight returns the markers of matches in snippets. Simple format
+// highlights matches with color if stdout is a terminal.
+func snippetHighlight(format string) ([2]string, error) {
+	if highlight := viper.GetString("search.highlight"); highlight != "" {
+		start, end, ok := strings.Cut(highlight, ",")
+		if !ok {
+			return [2]string{}, fmt.Errorf("invalid highlight: %q", highlight)
+		}
+		return [2]string{start, end}, nil
+	}
+
+	if strings.EqualFold(format, "simple") && isTerminal(os.Stdout) {
+		return ansiHighlight, nil
+	}
+	return [2]string{}, nil
+}
+
+// isTerminal reports whether the file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // formatSimple outputs results in a simple tab-separated format
 func formatSimple(clips []clipboard.Clip) error {
 	for _, clip := range clips {
@@ -128,8 +224,12 @@ func formatTemplate(clips []clipboard.Clip, tmplStr string) error {
 	return nil
 }
 
-// simpleClip extracts and formats text from a clipboard item
+// simpleClip extracts and formats text from a clipboard item. The snippet is
+// shown in full, since cutting it may cut the highlight.
 func simpleClip(clip clipboard.Clip) string {
+	if clip.Snippet != "" {
+		return simpleText(clip.Snippet)
+	}
 	text := fallbackText(clip.Text, clip.BlobPath, clip.Metadata)
 	out := simpleText(text)
 	if len(out) > 100 {
@@ -4,52 +4,114 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
-	"strings"
+	"syscall"
 
 	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	Command.AddCommand(setCommand)
+	fset := setCommand.Flags()
+	fset.BoolP(
+		"foreground", "F", false,
+		"serve the clipboard in foreground instead of forking",
+	)
+	fset.BoolP("primary", "p", false, "set to primary selection")
+	fset.String("seat", "", "set to selection of given seat (default first)")
 }
 
-// FIXME: please fix me......
-
 var setCommand = &cobra.Command{
-	Use:   "set",
+	Use:   "set <id>",
 	Short: "Set content of given id to clipboard",
-	Args:  cobra.ExactArgs(1),
+	Example: `
+  # Set item with ID 42 to clipboard
+  yankd set 42
+
+  # Set item with ID 42 to primary selection (middle-click paste)
+  yankd set 42 --primary
+
+  # Pick an item with fzf and set it to clipboard
+  yankd search | fzf | awk '{ print $1 }' | xargs yankd set
+  `,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		id, err := strconv.Atoi(args[0])
 		if err != nil {
 			return err
 		}
-		clip, err := db.Get(cmd.Context(), uint(id))
+		primary, err := cmd.Flags().GetBool("primary")
+		if err != nil {
+			return err
+		}
+		selection := clipboard.SelectionClipboard
+		if primary {
+			selection = clipboard.SelectionPrimary
+		}
+		seat, err := cmd.Flags().GetString("seat")
 		if err != nil {
 			return err
 		}
-		defer db.Close()
 
-		// TODO: set native protocal to set clipboard
-		if clip.BlobPath == "" {
-			slog.Debug("setting text content", "size", len(clip.Text))
-			wlCopy := exec.Command("wl-copy")
-			wlCopy.Stdin = strings.NewReader(clip.Text)
-			return wlCopy.Run()
+		// the daemon serves the clipboard, no need to fork
+		if c := dialDaemon(); c != nil {
+			defer c.Close()
+			return c.Set(cmd.Context(), uint(id), selection, seat)
+		}
+
+		clip, err := db.Get(cmd.Context(), uint(id))
+		if err != nil {
+			return err
+		}
+		// serving the clipboard can take forever, don't hold the database
+		if err := db.Close(); err != nil {
+			return err
 		}
 
-		slog.Debug("setting binary content", "size", len(clip.Text))
-		file, err := os.Open(clip.BlobPath)
+		foreground, err := cmd.Flags().GetBool("foreground")
 		if err != nil {
 			return err
 		}
-		defer file.Close()
+		if !foreground {
+			return forkForeground(cmd)
+		}
 
-		wlCopy := exec.Command("wl-copy")
-		wlCopy.Stdin = file
+		if err := db.LoadBlob(&clip); err != nil {
+			return err
+		}
 
-		return wlCopy.Run()
+		slog.Debug(
+			"setting clipboard content",
+			"id", clip.ID,
+			"text-size", len(clip.Text),
+			"blob-size", len(clip.Blob),
+		)
+		return clipboard.Set(cmd.Context(), clip, selection, seat)
 	},
 }
+
+// forkForeground starts the current command again with --foreground in a new
+// session, so that it keeps serving the clipboard after this process exits.
+func forkForeground(cmd *cobra.Command) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// the flag is added after the command name, since arguments after -- are
+	// never parsed as flags
+	args := slices.Clone(os.Args[1:])
+	i := slices.Index(args, cmd.Name())
+	args = slices.Insert(args, i+1, "--foreground")
+	child := exec.Command(exe, args...)
+	child.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := child.Start(); err != nil {
+		return err
+	}
+
+	slog.Debug("forked to background", "pid", child.Process.Pid)
+	return child.Process.Release()
+}
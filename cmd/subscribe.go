@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/Nadim147c/yankd/internal/daemon"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(subscribeCommand)
+	fset := subscribeCommand.Flags()
+	fset.StringP(
+		"format", "f", "json-stream",
+		"output format (simple, json, json-stream, or Go template string)",
+	)
+}
+
+var subscribeCommand = &cobra.Command{
+	Use:   "subscribe",
+	Short: "Print clipboard history changes as they happen",
+	Long: `Print clipboard history changes as they happen, while yankd watch is
+running.
+
+With json or json-stream format, each change is printed as a JSON object per
+line. The type of the object is one of:
+
+  clip     an item is stored or copied again, with the fields of the item
+  delete   items are deleted, with ids and count of the deleted items
+  wipe     the history is wiped, with count of the deleted items
+  pause    recording is paused, with until if paused for a while
+  resume   recording is resumed
+
+The simple and template formats print the stored items, like search.`,
+	Example: `
+  # Print each new item as JSON
+  yankd subscribe
+
+  # Print the text of each new item
+  yankd subscribe --format '{{.Text | simplify}}{{"\n"}}'
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return err
+		}
+		printEvent, err := eventPrinter(format)
+		if err != nil {
+			return err
+		}
+
+		c, err := daemon.Dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to yankd watch: %w", err)
+		}
+		defer c.Close()
+
+		for e, err := range c.Subscribe(cmd.Context()) {
+			if err != nil {
+				return err
+			}
+			if err := printEvent(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// eventPrinter returns the function printing an event in the format.
+func eventPrinter(format string) (func(daemon.Event) error, error) {
+	switch strings.ToLower(format) {
+	case "json", "json-stream":
+		encoder := json.NewEncoder(os.Stdout)
+		return func(e daemon.Event) error { return encoder.Encode(e) }, nil
+	case "simple":
+		return func(e daemon.Event) error {
+			if e.Clip == nil {
+				return nil
+			}
+			return formatSimple([]clipboard.Clip{*e.Clip})
+		}, nil
+	}
+
+	tmpl, err := template.New("subscribe").Funcs(templateFunc).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return func(e daemon.Event) error {
+		if e.Clip == nil {
+			return nil
+		}
+		return tmpl.Execute(os.Stdout, e.Clip)
+	}, nil
+}
@@ -2,38 +2,365 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/Nadim147c/yankd/internal/config"
+	"github.com/Nadim147c/yankd/internal/daemon"
 	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/Nadim147c/yankd/internal/ignore"
 	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func init() {
 	Command.AddCommand(watchCommand)
+	fset := watchCommand.Flags()
+	fset.BoolP(
+		"persist", "p", false,
+		"keep the latest clip in clipboard after the source application exits",
+	)
+	fset.Bool("primary", false, "record the primary selection")
+	fset.Int(
+		"max-retries", 0,
+		"give up after failing to reconnect this many times (0 retries forever)",
+	)
+	fset.Duration(
+		"read-timeout", 5*time.Second,
+		"give up reading an offer after this long (0 waits forever)",
+	)
+	fset.String(
+		"max-size", "64MiB",
+		"maximum size of an offer kept in memory (0 is unlimited)",
+	)
+	fset.StringArray(
+		"mime-limit", nil,
+		"timeout and size limit for matching mime types (PATTERN=TIMEOUT,SIZE)",
+	)
+	fset.String(
+		"oversized", "skip",
+		"what to do with offers over max size (skip, blob)",
+	)
+	fset.StringArray(
+		"sensitive-mime", clipboard.DefaultSensitiveMimes,
+		"never record offers with a mime type matching this pattern",
+	)
+	fset.StringArray(
+		"ignore-text", nil,
+		"never record text matching the rule (NAME=REGEX)",
+	)
+	fset.StringArray(
+		"ignore-mime", nil,
+		"never record items with a mime type matching this pattern",
+	)
+	fset.Int(
+		"min-length", 0,
+		"never record text shorter than this many characters (0 is unlimited)",
+	)
+	fset.Int(
+		"max-length", 0,
+		"never record text longer than this many characters (0 is unlimited)",
+	)
+	addRetentionFlags(watchCommand)
+}
+
+// pruneInterval is the min interval between pruning the history while watching
+const pruneInterval = time.Minute
+
+// watchOptions creates the clipboard options from the flags.
+func watchOptions() (clipboard.Options, error) {
+	opts := clipboard.Options{
+		Persist:     viper.GetBool("watch.persist"),
+		Primary:     viper.GetBool("watch.primary"),
+		MaxRetries:  viper.GetInt("watch.max-retries"),
+		ReadTimeout: viper.GetDuration("watch.read-timeout"),
+		// empty patterns are dropped, so the list can be cleared with ""
+		SensitiveMimes: slices.DeleteFunc(
+			viper.GetStringSlice("watch.sensitive-mime"),
+			func(s string) bool { return s == "" },
+		),
+	}
+
+	maxSize, err := humanize.ParseBytes(viper.GetString("watch.max-size"))
+	if err != nil {
+		return opts, fmt.Errorf("invalid max size: %w", err)
+	}
+	opts.MaxSize = int64(maxSize)
+
+	for _, s := range viper.GetStringSlice("watch.mime-limit") {
+		limit, err := clipboard.ParseLimit(s)
+		if err != nil {
+			return opts, err
+		}
+		opts.Limits = append(opts.Limits, limit)
+	}
+
+	switch oversized := viper.GetString("watch.oversized"); oversized {
+	case "skip":
+	case "blob":
+		opts.SpillDir, err = db.SpillDir()
+		if err != nil {
+			return opts, err
+		}
+	default:
+		return opts, fmt.Errorf("invalid oversized action: %q", oversized)
+	}
+
+	return opts, nil
+}
+
+// ignoreRules creates the rules of ignored clips from the flags.
+func ignoreRules() (ignore.Rules, error) {
+	rules := ignore.Rules{
+		MinLength: viper.GetInt("watch.min-length"),
+		MaxLength: viper.GetInt("watch.max-length"),
+	}
+	if rules.MinLength < 0 || rules.MaxLength < 0 {
+		return rules, errors.New("text length limits can not be negative")
+	}
+
+	for _, s := range viper.GetStringSlice("watch.ignore-text") {
+		rule, err := ignore.ParseText(s)
+		if err != nil {
+			return rules, err
+		}
+		rules.Texts = append(rules.Texts, rule)
+	}
+
+	for _, pattern := range viper.GetStringSlice("watch.ignore-mime") {
+		if err := ignore.ValidateMime(pattern); err != nil {
+			return rules, err
+		}
+		rules.Mimes = append(rules.Mimes, pattern)
+	}
+	return rules, nil
 }
 
 var watchCommand = &cobra.Command{
 	Use:   "watch",
 	Short: "Watch for clipboard changes",
+	Long: `Watch for clipboard changes and record them into the history.
+
+The watcher serves an API on XDG_RUNTIME_DIR/yankd.sock. The search, set,
+delete and wipe commands use it while the watcher is running, and access the
+database directly otherwise. Changes of the history are streamed to yankd
+subscribe.
+
+Items matching an ignore rule are never recorded: text matching a regex of
+--ignore-text, items with a mime type matching --ignore-mime, and text shorter
+than --min-length or longer than --max-length characters. Each ignored item
+is logged with the name of the rule.
+
+The ignore rules and retention limits are applied when the config file
+changes. The watcher reconnects only if the other options changed.`,
+	PreRunE: bindSection("watch"),
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		slog.Info("yankd watch starting", "version", Command.Version)
 		ctx := cmd.Context()
 
-		clips := make(chan clipboard.Clip)
-		context.AfterFunc(ctx, func() { close(clips) })
-
-		go clipboard.Watch(ctx, clips)
-
+		// encryption is enabled before the spill directory is chosen
+		if err := db.InitializeCrypt(ctx); err != nil {
+			return err
+		}
 		if err := db.InitializeFTS(); err != nil {
 			return err
 		}
 		defer db.Close()
 
-		for clip := range clips {
-			slog.Debug("Saving content to clipboard history", "mime", clip.Mime)
-			db.Insert(ctx, clip)
+		opts, err := watchOptions()
+		if err != nil {
+			return err
+		}
+		retention, err := retentionOptions()
+		if err != nil {
+			return err
+		}
+		rules, err := ignoreRules()
+		if err != nil {
+			return err
+		}
+		latest := func() (clipboard.Clip, error) {
+			clip, err := db.Latest(ctx, clipboard.SelectionClipboard)
+			if err != nil {
+				return clip, err
+			}
+			return clip, db.LoadBlob(&clip)
+		}
+		opts.Latest = latest
+
+		configChanged, err := config.Watch(ctx)
+		if err != nil {
+			return err
+		}
+
+		srv, err := daemon.Listen()
+		if err != nil {
+			slog.Warn("daemon API is not available", "error", err)
+		} else {
+			go srv.Serve(ctx)
+			defer srv.Close()
+		}
+
+		var pruned time.Time
+		prune := func() {
+			if retention.IsZero() || time.Since(pruned) < pruneInterval {
+				return
+			}
+			pruned = time.Now()
+			ids, err := db.Prune(ctx, retention)
+			if err != nil {
+				slog.Error("failed to prune clipboard history", "error", err)
+			}
+			if len(ids) != 0 && srv != nil {
+				srv.Publish(daemon.Event{
+					Type:  daemon.EventDelete,
+					IDs:   ids,
+					Count: len(ids),
+				})
+			}
+		}
+		prune()
+
+		record := func(clip clipboard.Clip) {
+			if srv != nil && srv.Paused() {
+				slog.Info("recording is paused, dropping clip", "mime", clip.Mime)
+				db.Discard(clip)
+				return
+			}
+			if rule, ok := rules.Match(clip); ok {
+				slog.Info("ignoring clip", "rule", rule, "mime", clip.Mime)
+				db.Discard(clip)
+				return
+			}
+
+			slog.Debug(
+				"Saving content to clipboard history",
+				"mime", clip.Mime,
+				"selection", clip.Selection,
+			)
+			stored, err := db.Insert(ctx, clip)
+			if err == nil && srv != nil {
+				srv.Publish(daemon.Event{Type: daemon.EventClip, Clip: &stored})
+			}
+			prune()
+		}
+
+		// reload applies the changed config file. The ignore rules and the
+		// retention limits are replaced in place, and true is returned if the
+		// watcher has to reconnect with the new options.
+		reload := func() bool {
+			// invalid options keep the watcher running with the previous ones
+			path := viper.ConfigFileUsed()
+			if problems := config.Check(path); len(problems) != 0 {
+				slog.Error(
+					"invalid config, keeping previous options",
+					"path", path,
+					"error", errors.Join(problems...),
+				)
+				return false
+			}
+			if err := config.Reload(); err != nil {
+				slog.Error("failed to reload config", "error", err)
+				return false
+			}
+			newOpts, err := watchOptions()
+			if err != nil {
+				slog.Error("invalid config, keeping previous options", "error", err)
+				return false
+			}
+			newRetention, err := retentionOptions()
+			if err != nil {
+				slog.Error("invalid config, keeping previous options", "error", err)
+				return false
+			}
+			newRules, err := ignoreRules()
+			if err != nil {
+				slog.Error("invalid config, keeping previous options", "error", err)
+				return false
+			}
+
+			retention, rules = newRetention, newRules
+			pruned = time.Time{}
+			prune()
+			slog.Info("config reloaded", "path", path)
+
+			newOpts.Latest = latest
+			if sameConnection(opts, newOpts) {
+				return false
+			}
+			opts = newOpts
+			return true
+		}
+
+		for {
+			err := watchClips(ctx, opts, configChanged, reload, record)
+			if !errors.Is(err, errConfigChanged) {
+				return err
+			}
+			slog.Info("restarting watcher with the new options")
 		}
-		return ctx.Err()
 	},
 }
+
+// errConfigChanged stops watching to watch again with the options of the
+// changed config file
+var errConfigChanged = errors.New("config file changed")
+
+// watchClips records the clips copied until watching fails. The config file is
+// reloaded when it changes, and errConfigChanged is returned if reload reports
+// the watcher has to reconnect.
+func watchClips(
+	ctx context.Context,
+	opts clipboard.Options,
+	configChanged <-chan struct{},
+	reload func() bool,
+	record func(clipboard.Clip),
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	clips := make(chan clipboard.Clip)
+	watchErr := make(chan error, 1)
+	go func() {
+		defer close(clips)
+		watchErr <- clipboard.WatchRetry(ctx, clips, opts)
+	}()
+
+	for {
+		select {
+		case clip, ok := <-clips:
+			if !ok {
+				return <-watchErr
+			}
+			record(clip)
+		case <-configChanged:
+			if !reload() {
+				continue
+			}
+			cancel()
+			for clip := range clips {
+				db.Discard(clip)
+			}
+			<-watchErr
+			return errConfigChanged
+		}
+	}
+}
+
+// sameConnection reports whether the watcher with options a serves the
+// options b without reconnecting. Latest is not compared.
+func sameConnection(a, b clipboard.Options) bool {
+	return a.Persist == b.Persist &&
+		a.Primary == b.Primary &&
+		a.MaxRetries == b.MaxRetries &&
+		a.ReadTimeout == b.ReadTimeout &&
+		a.MaxSize == b.MaxSize &&
+		slices.Equal(a.Limits, b.Limits) &&
+		a.SpillDir == b.SpillDir &&
+		slices.Equal(a.SensitiveMimes, b.SensitiveMimes)
+}
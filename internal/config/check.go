@@ -0,0 +1,234 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/Nadim147c/yankd/internal/ignore"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/dustin/go-humanize"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/viper"
+)
+
+// Keys returns the keys of the config file in the order of the schema. The
+// keys of a section are prefixed with the section, e.g. watch.primary.
+func Keys() []string {
+	return structKeys(reflect.TypeFor[Config](), "")
+}
+
+// structKeys returns the keys of the struct t, prefixed with prefix.
+func structKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key := prefix + f.Tag.Get("mapstructure")
+		if f.Type.Kind() == reflect.Struct {
+			keys = append(keys, structKeys(f.Type, key+".")...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Section returns the section of the config key, or an empty string for keys
+// of every command.
+func Section(key string) string {
+	section, _, ok := strings.Cut(key, ".")
+	if !ok {
+		return ""
+	}
+	return section
+}
+
+// Check validates the config file against the schema. Returns every problem
+// found.
+func Check(path string) []error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return []error{err}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return []error{parseError(b, err)}
+	}
+
+	var errs []error
+	known := Keys()
+	for _, key := range slices.Sorted(slices.Values(v.AllKeys())) {
+		if slices.Contains(known, key) {
+			continue
+		}
+		if near := suggest(key, known); near != "" {
+			errs = append(errs, fmt.Errorf(
+				"'%s' is not a config key, did you mean '%s'", key, near,
+			))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("'%s' is not a config key", key))
+	}
+
+	// values failing to decode are left unset, so the others are validated
+	var c Config
+	if err := v.Unmarshal(&c); err != nil {
+		errs = append(errs, unjoin(err)...)
+	}
+	if err := c.Validate(); err != nil {
+		errs = append(errs, unjoin(err)...)
+	}
+	return errs
+}
+
+// suggest returns the config key the unknown key is likely meant to be, or an
+// empty string.
+func suggest(key string, known []string) string {
+	// mistyped separators and keys outside of their section are the most
+	// common mistakes
+	key = strings.ReplaceAll(key, "_", "-")
+	_, name, _ := strings.Cut(key, ".")
+	for _, near := range []string{
+		key,
+		strings.ReplaceAll(key, ".", "-"),
+		name,
+		strings.ReplaceAll(name, ".", "-"),
+	} {
+		if near == "" {
+			continue
+		}
+		for _, k := range known {
+			if k == near || strings.HasSuffix(k, "."+near) {
+				return k
+			}
+		}
+	}
+	return ""
+}
+
+// unjoin returns the errors joined into err, without the message wrapping
+// them.
+func unjoin(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, unjoin(err)...)
+	}
+	return errs
+}
+
+// parseError adds the line and column to the syntax error of the config file
+// b, if the decoder doesn't.
+func parseError(b []byte, err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		tomlErr   *toml.DecodeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		line, col := position(b, syntaxErr.Offset)
+		return fmt.Errorf("line %d, column %d: %w", line, col, syntaxErr)
+	case errors.As(err, &typeErr):
+		line, col := position(b, typeErr.Offset)
+		return fmt.Errorf("line %d, column %d: %w", line, col, typeErr)
+	case errors.As(err, &tomlErr):
+		line, col := tomlErr.Position()
+		return fmt.Errorf("line %d, column %d: %w", line, col, tomlErr)
+	}
+	// yaml errors have the line already
+	return errors.Unwrap(err)
+}
+
+// position returns the line and column of the byte offset in b.
+func position(b []byte, offset int64) (int, int) {
+	before := string(b[:min(offset, int64(len(b)))])
+	line := 1 + strings.Count(before, "\n")
+	// the offset is after the invalid byte
+	col := len(before) - strings.LastIndexByte(before, '\n') - 1
+	return line, col
+}
+
+// Validate reports the values of the config which decode but are invalid.
+// Unset keys are valid.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		args = append([]any{key}, args...)
+		errs = append(errs, fmt.Errorf("'%s' "+format, args...))
+	}
+	oneOf := func(key, value string, allowed ...string) {
+		if value != "" && !slices.Contains(allowed, value) {
+			invalid(
+				key, "must be one of %s, got %q",
+				strings.Join(allowed, ", "), value,
+			)
+		}
+	}
+	size := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if _, err := humanize.ParseBytes(value); err != nil {
+			invalid(key, "invalid size %q", value)
+		}
+	}
+	nonNegative := func(key string, negative bool) {
+		if negative {
+			invalid(key, "can not be negative")
+		}
+	}
+
+	nonNegative("verbose", c.Verbose < 0)
+	oneOf(
+		"fts-tokenizer", c.FTSTokenizer,
+		TokenizerUnicode, TokenizerTrigram,
+	)
+
+	w := c.Watch
+	nonNegative("watch.max-retries", w.MaxRetries < 0)
+	nonNegative("watch.read-timeout", w.ReadTimeout < 0)
+	size("watch.max-size", w.MaxSize)
+	for i, s := range w.MimeLimits {
+		if _, err := clipboard.ParseLimit(s); err != nil {
+			invalid(fmt.Sprintf("watch.mime-limit[%d]", i), "%v", err)
+		}
+	}
+	oneOf("watch.oversized", w.Oversized, "skip", "blob")
+	for i, s := range w.IgnoreTexts {
+		if _, err := ignore.ParseText(s); err != nil {
+			invalid(fmt.Sprintf("watch.ignore-text[%d]", i), "%v", err)
+		}
+	}
+	for i, pattern := range w.IgnoreMimes {
+		if err := ignore.ValidateMime(pattern); err != nil {
+			invalid(fmt.Sprintf("watch.ignore-mime[%d]", i), "%v", err)
+		}
+	}
+	nonNegative("watch.min-length", w.MinLength < 0)
+	nonNegative("watch.max-length", w.MaxLength < 0)
+	nonNegative("watch.max-items", w.MaxItems < 0)
+	nonNegative("watch.max-age", w.MaxAge < 0)
+	size("watch.max-blob-size", w.MaxBlobSize)
+
+	s := c.Search
+	nonNegative("search.limit", s.Limit < 0)
+	oneOf(
+		"search.selection", s.Selection,
+		string(clipboard.SelectionClipboard), string(clipboard.SelectionPrimary),
+	)
+	if s.Highlight != "" && !strings.Contains(s.Highlight, ",") {
+		invalid("search.highlight", "must be START,END, got %q", s.Highlight)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+// Package config loads the config file of yankd. The keys of the config file
+// are the long names of the flags, in the section of the command if they are
+// specific to it. A flag or YANKD_ environment variable overrides the value of
+// the config file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/viper"
+)
+
+// Extensions are the extensions of the config file, which is looked up in this
+// order
+var Extensions = []string{"json", "toml", "yaml", "yml"}
+
+// EnvKeyReplacer maps config keys to the names of their environment variables,
+// e.g. watch.max-items to YANKD_WATCH_MAX_ITEMS.
+var EnvKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// Env returns the environment variable overriding the config key.
+func Env(key string) string {
+	return "YANKD_" + strings.ToUpper(EnvKeyReplacer.Replace(key))
+}
+
+// Find returns the path of the config file, the first config.EXT existing in
+// XDG_CONFIG_HOME/yankd and XDG_CONFIG_DIRS/yankd. Returns an empty string if
+// there is no config file.
+func Find() string {
+	dirs := slices.Concat([]string{xdg.ConfigHome}, xdg.ConfigDirs)
+	for _, dir := range dirs {
+		for _, ext := range Extensions {
+			path := filepath.Join(dir, "yankd", "config."+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// Load reads the config file given by the config key, or found by Find, into
+// viper. A missing config file is an error only if it is given.
+func Load() error {
+	path := viper.GetString("config")
+	if path == "" {
+		path = Find()
+	}
+	if path == "" {
+		return nil
+	}
+
+	viper.SetConfigFile(path)
+	return Reload()
+}
+
+// Reload reads the loaded config file again. The previous values are kept if
+// the file can't be read.
+func Reload() error {
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return errors.New("no config file is loaded")
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	return nil
+}
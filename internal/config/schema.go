@@ -0,0 +1,96 @@
+package config
+
+import "time"
+
+// Config is the schema of the config file. The keys are the long names of the
+// flags. The keys of a command are in the section of the command, e.g.
+// watch.max-items for --max-items of watch. Flags which only apply to a single
+// invocation, e.g. --foreground of set, are not config keys. Durations are
+// strings like 90s, 15m or 720h, and sizes are strings like 64MiB or 1GB.
+//
+// The database, fts-tokenizer and key-file keys are read only when a command
+// starts, the watch section is applied to a running watcher when the config
+// file changes.
+type Config struct {
+	// Database is the database directory (default XDG_DATA_HOME/yankd)
+	Database string `mapstructure:"database"`
+	// Verbose is the log level, 1 logs info and 2 logs debug messages
+	Verbose int `mapstructure:"verbose"`
+	// Quiet suppresses all the logs
+	Quiet bool `mapstructure:"quiet"`
+	// FTSTokenizer is the tokenizer of the search index, TokenizerUnicode or
+	// TokenizerTrigram
+	FTSTokenizer string `mapstructure:"fts-tokenizer"`
+	// KeyFile is the file with the key to encrypt history. The passphrase is
+	// only read from YANKD_PASSPHRASE, never from the config file.
+	KeyFile string `mapstructure:"key-file"`
+
+	Watch  WatchSection  `mapstructure:"watch"`
+	Search SearchSection `mapstructure:"search"`
+}
+
+// WatchSection is the watch section of the config file. The retention limits
+// apply to prune too.
+type WatchSection struct {
+	// Persist keeps the latest clip in clipboard after the source application
+	// exits
+	Persist bool `mapstructure:"persist"`
+	// Primary records the primary selection
+	Primary bool `mapstructure:"primary"`
+	// MaxRetries gives up after failing to reconnect this many times, 0
+	// retries forever
+	MaxRetries int `mapstructure:"max-retries"`
+	// ReadTimeout gives up reading an offer after this long, 0 waits forever
+	ReadTimeout time.Duration `mapstructure:"read-timeout"`
+	// MaxSize is the maximum size of an offer kept in memory, 0 is unlimited
+	MaxSize string `mapstructure:"max-size"`
+	// MimeLimits are the timeout and size limits of matching mime types as
+	// PATTERN=TIMEOUT,SIZE
+	MimeLimits []string `mapstructure:"mime-limit"`
+	// Oversized is what to do with offers over max size: skip, blob
+	Oversized string `mapstructure:"oversized"`
+	// SensitiveMimes are the patterns of mime types never recorded
+	SensitiveMimes []string `mapstructure:"sensitive-mime"`
+	// IgnoreTexts are the rules of text never recorded as NAME=REGEX, the
+	// name is logged when a clip is ignored
+	IgnoreTexts []string `mapstructure:"ignore-text"`
+	// IgnoreMimes are the patterns of the mime type of items never recorded
+	IgnoreMimes []string `mapstructure:"ignore-mime"`
+	// MinLength never records text shorter than this many characters, 0 is
+	// unlimited
+	MinLength int `mapstructure:"min-length"`
+	// MaxLength never records text longer than this many characters, 0 is
+	// unlimited
+	MaxLength int `mapstructure:"max-length"`
+
+	// MaxItems keeps at most this many unpinned items, 0 is unlimited
+	MaxItems int `mapstructure:"max-items"`
+	// MaxAge deletes unpinned items not used for this long, 0 is unlimited
+	MaxAge time.Duration `mapstructure:"max-age"`
+	// MaxBlobSize keeps at most this much blob data of unpinned items, 0 is
+	// unlimited
+	MaxBlobSize string `mapstructure:"max-blob-size"`
+}
+
+// SearchSection is the search section of the config file.
+type SearchSection struct {
+	// Sync synchronizes the search index before search
+	Sync bool `mapstructure:"sync"`
+	// Limit is the number of items to display
+	Limit int `mapstructure:"limit"`
+	// Selection only shows items from the selection: clipboard, primary
+	Selection string `mapstructure:"selection"`
+	// Format is the output format
+	Format string `mapstructure:"format"`
+	// Highlight marks matches in snippets as START,END
+	Highlight string `mapstructure:"highlight"`
+}
+
+// FTS5 tokenizers of the search index
+const (
+	// TokenizerUnicode matches words and word prefixes
+	TokenizerUnicode = "unicode61"
+	// TokenizerTrigram matches any substring of at least 3 characters, e.g.
+	// the middle of paths, hashes and CJK text
+	TokenizerTrigram = "trigram"
+)
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// debounce is waited after a change of the config file before it is reported,
+// since editors write, rename and chmod the file on save
+const debounce = 200 * time.Millisecond
+
+// Watch returns a channel receiving a value when the loaded config file
+// changes, until ctx is cancelled. Changes less than debounce apart are
+// reported once. The config file is not read again, see Reload. The channel never
+// receives if no config file is loaded.
+func Watch(ctx context.Context) (<-chan struct{}, error) {
+	changed := make(chan struct{}, 1)
+
+	path := viper.ConfigFileUsed()
+	if path == "" {
+		return changed, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("failed to create config watcher", "error", err)
+		return nil, err
+	}
+	// the directory is watched since editors replace the file on save, and
+	// home-manager replaces the symlink to the file
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		slog.Error("failed to watch config directory", "error", err)
+		return nil, err
+	}
+
+	target, _ := filepath.EvalSymlinks(path)
+	go func() {
+		defer watcher.Close()
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("config watcher error", "error", err)
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				current, _ := filepath.EvalSymlinks(path)
+				written := filepath.Clean(event.Name) == path &&
+					event.Has(fsnotify.Write|fsnotify.Create)
+				if !written && (current == "" || current == target) {
+					continue
+				}
+				target = current
+
+				slog.Debug("config file changed", "path", path, "op", event.Op)
+				timer.Reset(debounce)
+			}
+		}
+	}()
+
+	slog.Debug("watching config file", "path", path)
+	return changed, nil
+}
@@ -0,0 +1,224 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/spf13/viper"
+)
+
+// dialTimeout limits connecting to the daemon
+const dialTimeout = time.Second
+
+// Client is a connection to the daemon
+type Client struct {
+	conn net.Conn
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+// Dial connects to the daemon serving the configured database. Fails if the
+// daemon isn't running, serves another database or speaks another version of
+// the protocol.
+func Dial() (*Client, error) {
+	database, err := filepath.Abs(viper.GetString("database"))
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", SocketPath(), dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn: conn,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(conn),
+	}
+
+	var hello HelloResult
+	err = c.call(
+		context.Background(),
+		MethodHello,
+		HelloParams{Database: database},
+		&hello,
+	)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	slog.Debug("connected to daemon", "version", hello.Version)
+	return c, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// call sends a request and decodes its result into result.
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	params any,
+	result any,
+) error {
+	req := Request{Version: Version, Method: method}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = b
+	}
+
+	// requests are cancelled by closing the connection
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	defer stop()
+
+	if err := c.enc.Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp Response
+	if err := c.dec.Decode(&resp); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// Search searches the history, see db.Search.
+func (c *Client) Search(
+	ctx context.Context,
+	query string,
+	limit int,
+	sync bool,
+	selection clipboard.Selection,
+) ([]clipboard.Clip, error) {
+	var clips []clipboard.Clip
+	err := c.call(ctx, MethodSearch, SearchParams{
+		Query:     query,
+		Limit:     limit,
+		Sync:      sync,
+		Selection: selection,
+	}, &clips)
+	return clips, err
+}
+
+// Get returns the clip of given id with its blobs loaded.
+func (c *Client) Get(ctx context.Context, id uint) (clipboard.Clip, error) {
+	var result GetResult
+	err := c.call(ctx, MethodGet, GetParams{ID: id}, &result)
+	if err != nil {
+		return result.Clip, err
+	}
+
+	for i := range result.Clip.Representations {
+		if i < len(result.Data) {
+			result.Clip.Representations[i].Data = result.Data[i]
+		}
+	}
+	return result.Clip, nil
+}
+
+// Set sets the clip of given id to the selection of the seat. The daemon
+// serves the clipboard.
+func (c *Client) Set(
+	ctx context.Context,
+	id uint,
+	selection clipboard.Selection,
+	seat string,
+) error {
+	return c.call(ctx, MethodSet, SetParams{
+		ID:        id,
+		Selection: selection,
+		Seat:      seat,
+	}, nil)
+}
+
+// Delete deletes the clips of given ids. Returns the number of deleted clips.
+func (c *Client) Delete(ctx context.Context, ids []uint) (int, error) {
+	var result CountResult
+	err := c.call(ctx, MethodDelete, DeleteParams{IDs: ids}, &result)
+	return result.Count, err
+}
+
+// Wipe deletes every clip. Returns the number of deleted clips.
+func (c *Client) Wipe(ctx context.Context) (int, error) {
+	var result CountResult
+	err := c.call(ctx, MethodWipe, nil, &result)
+	return result.Count, err
+}
+
+// Pause pauses recording for the duration, until resume if zero.
+func (c *Client) Pause(ctx context.Context, d time.Duration) (Status, error) {
+	var status Status
+	err := c.call(ctx, MethodPause, PauseParams{For: d}, &status)
+	return status, err
+}
+
+// Resume resumes recording.
+func (c *Client) Resume(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.call(ctx, MethodResume, nil, &status)
+	return status, err
+}
+
+// Status returns the recording state.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.call(ctx, MethodStatus, nil, &status)
+	return status, err
+}
+
+// Subscribe streams the events of the history until ctx is cancelled. Fails
+// if the daemon stops. The connection can't be used for other requests
+// afterwards.
+func (c *Client) Subscribe(ctx context.Context) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		if err := c.call(ctx, MethodSubscribe, nil, nil); err != nil {
+			yield(Event{}, err)
+			return
+		}
+
+		stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+		defer stop()
+
+		for {
+			var e Event
+			if err := c.dec.Decode(&e); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, io.EOF) {
+					err = errors.New("daemon closed the connection")
+				}
+				yield(e, fmt.Errorf("failed to read event: %w", err))
+				return
+			}
+			if !yield(e, nil) {
+				return
+			}
+		}
+	}
+}
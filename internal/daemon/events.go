@@ -0,0 +1,86 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+)
+
+// Types of the events
+const (
+	// EventClip is sent when a clip is stored, or copied again
+	EventClip = "clip"
+	// EventDelete is sent when clips are deleted
+	EventDelete = "delete"
+	// EventWipe is sent when the history is wiped
+	EventWipe = "wipe"
+	// EventPause is sent when recording is paused
+	EventPause = "pause"
+	// EventResume is sent when recording is resumed
+	EventResume = "resume"
+)
+
+// Event is a change of the history sent to subscribers
+type Event struct {
+	Type string `json:"type"`
+	// Clip is the stored clip of a clip event. Its fields are inlined into the
+	// JSON object of the event.
+	*clipboard.Clip
+	// IDs are the ids of the clips to delete of a delete event
+	IDs []uint `json:"ids,omitempty"`
+	// Count is the number of deleted clips of a delete or wipe event
+	Count int `json:"count,omitempty"`
+	// Until is when recording is resumed of a pause event, zero if paused
+	// until resume
+	Until time.Time `json:"until,omitzero"`
+}
+
+// subscriberBuffer is the number of events buffered for a subscriber. A
+// subscriber falling further behind is dropped, so that it can't hold up
+// recording.
+const subscriberBuffer = 64
+
+// bus fans out events to the subscribers
+type bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// subscribe returns a channel receiving the events published from now on, and
+// a function to unsubscribe. The channel is closed if the subscriber is
+// dropped.
+func (b *bus) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[chan Event]struct{})
+	}
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends the event to every subscriber without blocking.
+func (b *bus) publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
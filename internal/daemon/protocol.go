@@ -0,0 +1,134 @@
+// Package daemon implements the API the watcher serves on a unix socket, so
+// that commands don't open the database while the watcher is running.
+//
+// Requests and responses are JSON objects, one per line. A client sends a
+// request and reads its response before sending the next one. The first
+// request of a connection is hello, which fails if the protocol version or the
+// database of the client differs from the daemon:
+//
+//	-> {"version":1,"method":"hello","database":"/home/user/.local/share/yankd"}
+//	<- {"version":1,"result":{"version":1,"database":"/home/..."}}
+//	-> {"version":1,"method":"delete","params":{"ids":[42]}}
+//	<- {"version":1,"result":{"count":1}}
+//
+// After a successful subscribe request, the daemon writes an event per line
+// instead of responses until the connection is closed:
+//
+//	-> {"version":1,"method":"subscribe"}
+//	<- {"version":1,"result":{}}
+//	<- {"type":"clip","id":43,"text":"hello",...}
+//	<- {"type":"delete","ids":[42],"count":1}
+package daemon
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/adrg/xdg"
+)
+
+// Version is the version of the protocol
+const Version = 1
+
+// Methods of the API
+const (
+	MethodHello  = "hello"
+	MethodSearch = "search"
+	MethodGet    = "get"
+	MethodSet    = "set"
+	MethodDelete = "delete"
+	MethodWipe   = "wipe"
+	// MethodSubscribe turns the connection into a stream of events
+	MethodSubscribe = "subscribe"
+	MethodPause     = "pause"
+	MethodResume    = "resume"
+	MethodStatus    = "status"
+)
+
+// SocketPath returns the path of the socket of the daemon.
+func SocketPath() string {
+	return filepath.Join(xdg.RuntimeDir, "yankd.sock")
+}
+
+// Request is a request to the daemon
+type Request struct {
+	Version int             `json:"version"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the response of a request. Error is set if the request failed.
+type Response struct {
+	Version int             `json:"version"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// HelloParams are the parameters of hello
+type HelloParams struct {
+	// Database is the absolute path of the database directory of the client
+	Database string `json:"database"`
+}
+
+// HelloResult is the result of hello
+type HelloResult struct {
+	Version  int    `json:"version"`
+	Database string `json:"database"`
+}
+
+// SearchParams are the parameters of search
+type SearchParams struct {
+	Query     string              `json:"query"`
+	Limit     int                 `json:"limit"`
+	Sync      bool                `json:"sync,omitempty"`
+	Selection clipboard.Selection `json:"selection,omitempty"`
+}
+
+// GetParams are the parameters of get
+type GetParams struct {
+	ID uint `json:"id"`
+}
+
+// GetResult is the result of get, the clip with its blobs loaded
+type GetResult struct {
+	Clip clipboard.Clip `json:"clip"`
+	// Data is the data of each representation of the clip, which isn't
+	// marshaled with the representation
+	Data [][]byte `json:"data,omitempty"`
+}
+
+// SetParams are the parameters of set
+type SetParams struct {
+	ID        uint                `json:"id"`
+	Selection clipboard.Selection `json:"selection"`
+	Seat      string              `json:"seat,omitempty"`
+}
+
+// DeleteParams are the parameters of delete
+type DeleteParams struct {
+	IDs []uint `json:"ids"`
+}
+
+// CountResult is the result of delete and wipe
+type CountResult struct {
+	Count int `json:"count"`
+}
+
+// PauseParams are the parameters of pause
+type PauseParams struct {
+	// For is how long recording is paused, until resume if zero
+	For time.Duration `json:"for,omitempty"`
+}
+
+// Status is the recording state of the daemon, the result of pause, resume
+// and status
+type Status struct {
+	// Running is whether the daemon is running, it is false only if the
+	// client can't connect
+	Running bool `json:"running"`
+	Paused  bool `json:"paused"`
+	// Until is when recording is resumed, zero if paused until resume
+	Until time.Time `json:"until,omitzero"`
+}
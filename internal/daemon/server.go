@@ -0,0 +1,463 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/db"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/spf13/viper"
+)
+
+// handler handles the params of a request and returns its result
+type handler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Server serves the API on the socket
+type Server struct {
+	ln       *net.UnixListener
+	database string
+	handlers map[string]handler
+	events   bus
+	wg       sync.WaitGroup
+	// ctx is the context of Serve, clipboard set by clients is served until
+	// it is cancelled
+	ctx context.Context
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	// pauseMu guards the recording state
+	pauseMu sync.Mutex
+	paused  bool
+	until   time.Time
+	// resumeTimer resumes recording paused for a while
+	resumeTimer *time.Timer
+}
+
+// Listen listens on the socket. Fails if another daemon is listening on it; a
+// socket left by a crashed daemon is removed.
+func Listen() (*Server, error) {
+	database, err := filepath.Abs(viper.GetString("database"))
+	if err != nil {
+		return nil, err
+	}
+
+	path := SocketPath()
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("daemon is already listening on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("failed to remove stale socket", "path", path, "error", err)
+		return nil, err
+	}
+
+	// the socket is created with the umask, so it is never accessible to other
+	// users before the chmod. The umask is process wide, only the permissions
+	// of other users are masked.
+	umask := syscall.Umask(0o077)
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	syscall.Umask(umask)
+	if err != nil {
+		slog.Error("failed to listen on socket", "path", path, "error", err)
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		ln:       ln,
+		database: database,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.handlers = map[string]handler{
+		MethodHello:     s.hello,
+		MethodSearch:    search,
+		MethodGet:       get,
+		MethodSet:       s.set,
+		MethodDelete:    s.remove,
+		MethodWipe:      s.wipe,
+		MethodSubscribe: subscribe,
+		MethodPause:     s.pause,
+		MethodResume:    s.resume,
+		MethodStatus:    s.status,
+	}
+
+	slog.Info("daemon listening", "path", path)
+	return s, nil
+}
+
+// Serve accepts connections until ctx is cancelled or the server is closed.
+// Clipboard set by clients is served until ctx is cancelled.
+func (s *Server) Serve(ctx context.Context) error {
+	s.ctx = ctx
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	for {
+		conn, err := s.ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			slog.Error("failed to accept connection", "error", err)
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Go(func() {
+			s.serveConn(ctx, conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// Close stops listening, closes every connection and removes the socket.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// serveConn handles the requests of the connection until it is closed.
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	hello := false
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("failed to read request", "error", err)
+			}
+			return
+		}
+
+		slog.Debug("daemon request", "method", req.Method)
+		resp := Response{Version: Version}
+		result, err := s.handle(ctx, req, hello)
+		if err == nil {
+			hello = true
+			resp.Result, err = json.Marshal(result)
+		}
+		if err != nil {
+			slog.Debug("daemon request failed", "method", req.Method, "error", err)
+			resp.Error = err.Error()
+		}
+
+		if req.Method == MethodSubscribe && resp.Error == "" {
+			s.stream(conn, enc, resp)
+			return
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			slog.Debug("failed to write response", "error", err)
+			return
+		}
+	}
+}
+
+// Publish sends the event to the subscribers.
+func (s *Server) Publish(e Event) {
+	s.events.publish(e)
+}
+
+// stream writes the response of subscribe, then the events until the
+// connection is closed. The events are subscribed before the response, so the
+// client doesn't miss any event after it.
+func (s *Server) stream(conn net.Conn, enc *json.Encoder, resp Response) {
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	if err := enc.Encode(resp); err != nil {
+		slog.Debug("failed to write response", "error", err)
+		return
+	}
+
+	// the client doesn't send anything after subscribe, reading only ends
+	// when the connection is closed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(io.Discard, conn)
+	}()
+
+	slog.Debug("subscriber connected")
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				slog.Warn("dropped subscriber falling behind")
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				slog.Debug("failed to write event", "error", err)
+				return
+			}
+		case <-closed:
+			slog.Debug("subscriber disconnected")
+			return
+		}
+	}
+}
+
+// handle handles a request. Every request but hello is rejected until hello
+// succeeds.
+func (s *Server) handle(
+	ctx context.Context,
+	req Request,
+	hello bool,
+) (any, error) {
+	if req.Version != Version {
+		return nil, fmt.Errorf("unsupported protocol version %d", req.Version)
+	}
+	if !hello && req.Method != MethodHello {
+		return nil, errors.New("hello is required first")
+	}
+
+	h, ok := s.handlers[req.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %q", req.Method)
+	}
+	return h(ctx, req.Params)
+}
+
+// decode decodes the params of a request.
+func decode[T any](params json.RawMessage) (T, error) {
+	var p T
+	if len(params) == 0 {
+		return p, nil
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return p, fmt.Errorf("invalid params: %w", err)
+	}
+	return p, nil
+}
+
+func (s *Server) hello(_ context.Context, params json.RawMessage) (any, error) {
+	p, err := decode[HelloParams](params)
+	if err != nil {
+		return nil, err
+	}
+	if p.Database != s.database {
+		return nil, fmt.Errorf("daemon serves database %s", s.database)
+	}
+	return HelloResult{Version: Version, Database: s.database}, nil
+}
+
+func search(ctx context.Context, params json.RawMessage) (any, error) {
+	p, err := decode[SearchParams](params)
+	if err != nil {
+		return nil, err
+	}
+	return db.Search(ctx, p.Query, p.Limit, p.Sync, p.Selection)
+}
+
+func get(ctx context.Context, params json.RawMessage) (any, error) {
+	p, err := decode[GetParams](params)
+	if err != nil {
+		return nil, err
+	}
+
+	clip, err := db.Get(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.LoadBlob(&clip); err != nil {
+		return nil, err
+	}
+
+	result := GetResult{Clip: clip}
+	for rep := range slices.Values(clip.Representations) {
+		result.Data = append(result.Data, rep.Data)
+	}
+	return result, nil
+}
+
+// set sets the clip to the clipboard, which is served until the server is
+// stopped or another client takes the selection. Replies once the selection is
+// set.
+func (s *Server) set(ctx context.Context, params json.RawMessage) (any, error) {
+	p, err := decode[SetParams](params)
+	if err != nil {
+		return nil, err
+	}
+
+	clip, err := db.Get(ctx, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.LoadBlob(&clip); err != nil {
+		return nil, err
+	}
+
+	ready := make(chan struct{})
+	setErr := make(chan error, 1)
+	go func() {
+		err := clipboard.SetReady(
+			s.ctx, clip, p.Selection, p.Seat,
+			func() { close(ready) },
+		)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("failed to set clipboard", "id", clip.ID, "error", err)
+		}
+		setErr <- err
+	}()
+
+	select {
+	case <-ready:
+		return struct{}{}, nil
+	case err := <-setErr:
+		// serving may stop right after the selection is set
+		select {
+		case <-ready:
+			return struct{}{}, nil
+		default:
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Server) remove(
+	ctx context.Context,
+	params json.RawMessage,
+) (any, error) {
+	p, err := decode[DeleteParams](params)
+	if err != nil {
+		return nil, err
+	}
+	n, err := db.Delete(ctx, p.IDs)
+	if n > 0 {
+		s.Publish(Event{Type: EventDelete, IDs: p.IDs, Count: n})
+	}
+	return CountResult{Count: n}, err
+}
+
+func (s *Server) wipe(ctx context.Context, _ json.RawMessage) (any, error) {
+	n, err := db.Wipe(ctx)
+	if err == nil {
+		s.Publish(Event{Type: EventWipe, Count: n})
+	}
+	return CountResult{Count: n}, err
+}
+
+// subscribe only validates the request, the events are streamed by serveConn.
+func subscribe(context.Context, json.RawMessage) (any, error) {
+	return struct{}{}, nil
+}
+
+// Paused reports whether recording is paused. Clips copied while paused are
+// dropped by the watcher.
+func (s *Server) Paused() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.paused
+}
+
+// currentStatus returns the recording state. pauseMu must be held.
+func (s *Server) currentStatus() Status {
+	return Status{Running: true, Paused: s.paused, Until: s.until}
+}
+
+// pause pauses recording until resume, or for the given duration.
+func (s *Server) pause(_ context.Context, params json.RawMessage) (any, error) {
+	p, err := decode[PauseParams](params)
+	if err != nil {
+		return nil, err
+	}
+	if p.For < 0 {
+		return nil, fmt.Errorf("invalid pause duration: %s", p.For)
+	}
+
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+	s.paused = true
+	s.until = time.Time{}
+	if p.For > 0 {
+		s.until = time.Now().Add(p.For)
+		var t *time.Timer
+		t = time.AfterFunc(p.For, func() {
+			s.pauseMu.Lock()
+			defer s.pauseMu.Unlock()
+			// the timer may fire while pausing again stops it
+			if s.resumeTimer == t {
+				s.resumeLocked()
+			}
+		})
+		s.resumeTimer = t
+	}
+
+	slog.Info("recording paused", "for", p.For)
+	s.Publish(Event{Type: EventPause, Until: s.until})
+	return s.currentStatus(), nil
+}
+
+// resume resumes recording.
+func (s *Server) resume(context.Context, json.RawMessage) (any, error) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	if s.paused {
+		s.resumeLocked()
+	}
+	return s.currentStatus(), nil
+}
+
+// resumeLocked resumes recording. pauseMu must be held.
+func (s *Server) resumeLocked() {
+	if s.resumeTimer != nil {
+		s.resumeTimer.Stop()
+		s.resumeTimer = nil
+	}
+	s.paused = false
+	s.until = time.Time{}
+
+	slog.Info("recording resumed")
+	s.Publish(Event{Type: EventResume})
+}
+
+func (s *Server) status(context.Context, json.RawMessage) (any, error) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.currentStatus(), nil
+}
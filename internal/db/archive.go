@@ -0,0 +1,379 @@
+package db
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// An archive of the history contains clips.ndjson, a JSON record of a clip per
+// line, and the blob files in blobs/ named by their hash. The blob paths of
+// the records are relative to the archive. Text and blobs are not encrypted.
+const (
+	archiveClips = "clips.ndjson"
+	archiveBlobs = "blobs"
+)
+
+// ImportStats is the result of an import
+type ImportStats struct {
+	Imported int `json:"imported"`
+	// Duplicates are the clips already in history, which are merged into the
+	// existing clips
+	Duplicates int `json:"duplicates"`
+}
+
+// archiveBlobPath returns the path of the blob in an archive.
+func archiveBlobPath(hash clipboard.Hash) string {
+	return path.Join(archiveBlobs, hash.String())
+}
+
+// Export writes the history into a tar archive. Returns the number of exported
+// clips.
+func Export(ctx context.Context, w io.Writer) (int, error) {
+	tw := tar.NewWriter(w)
+	now := time.Now()
+	n, err := export(ctx, func(name string, b []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o600,
+			Size:     int64(len(b)),
+			ModTime:  now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(b)
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, tw.Close()
+}
+
+// ExportDir writes the history into an archive directory. Returns the number
+// of exported clips.
+func ExportDir(ctx context.Context, dir string) (int, error) {
+	if err := os.MkdirAll(filepath.Join(dir, archiveBlobs), 0o700); err != nil {
+		slog.Error(
+			"failed to create archive directory",
+			"path", dir,
+			"error", err,
+		)
+		return 0, err
+	}
+	return export(ctx, func(name string, b []byte) error {
+		return os.WriteFile(filepath.Join(dir, name), b, 0o600)
+	})
+}
+
+// export writes the files of the archive with put.
+func export(
+	ctx context.Context,
+	put func(name string, b []byte) error,
+) (int, error) {
+	db, err := GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	clips, err := gorm.G[clipboard.Clip](db).
+		Preload(binds.Clip.Representations.Name(), nil).
+		Order(binds.Clip.ID.Asc()).
+		Find(ctx)
+	if err != nil {
+		slog.Error("failed to get clips to export", "error", err)
+		return 0, err
+	}
+	if err := decryptClips(clips); err != nil {
+		return 0, err
+	}
+
+	var records bytes.Buffer
+	enc := json.NewEncoder(&records)
+	blobs := make(map[clipboard.Hash]string) // hash -> path
+
+	for i := range clips {
+		clip := &clips[i]
+		if clip.BlobPath != "" {
+			blobs[clip.BlobHash] = clip.BlobPath
+			clip.BlobPath = archiveBlobPath(clip.BlobHash)
+		}
+		for j := range clip.Representations {
+			rep := &clip.Representations[j]
+			if rep.BlobPath != "" {
+				blobs[rep.BlobHash] = rep.BlobPath
+				rep.BlobPath = archiveBlobPath(rep.BlobHash)
+			}
+		}
+		if err := enc.Encode(clip); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := put(archiveClips, records.Bytes()); err != nil {
+		slog.Error("failed to write clips to archive", "error", err)
+		return 0, err
+	}
+
+	for hash := range slices.Values(slices.Sorted(maps.Keys(blobs))) {
+		b, err := readBlob(blobs[hash])
+		if err != nil {
+			return 0, err
+		}
+		if err := put(archiveBlobPath(hash), b); err != nil {
+			slog.Error("failed to write blob to archive", "error", err)
+			return 0, err
+		}
+	}
+
+	slog.Info(
+		"clipboard history exported",
+		"clips", len(clips),
+		"blobs", len(blobs),
+	)
+	return len(clips), nil
+}
+
+// Import reads a tar archive written by Export into history. The archive is
+// extracted into a temporary directory first.
+func Import(ctx context.Context, r io.Reader) (ImportStats, error) {
+	dir, err := os.MkdirTemp("", "yankd-import-*")
+	if err != nil {
+		return ImportStats{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractArchive(r, dir); err != nil {
+		slog.Error("failed to extract archive", "error", err)
+		return ImportStats{}, fmt.Errorf("failed to extract archive: %w", err)
+	}
+	return ImportDir(ctx, dir)
+}
+
+// extractArchive extracts the files of the tar archive into dir.
+func extractArchive(r io.Reader, dir string) error {
+	if err := os.Mkdir(filepath.Join(dir, archiveBlobs), 0o700); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		known := name == archiveClips || path.Dir(name) == archiveBlobs
+		if !known || hdr.Typeflag != tar.TypeReg {
+			slog.Warn("skipping unknown file in archive", "name", hdr.Name)
+			continue
+		}
+
+		f, err := os.OpenFile(
+			filepath.Join(dir, filepath.FromSlash(name)),
+			os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+			0o600,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportDir reads an archive directory written by ExportDir into history.
+// Clips already in history are deduplicated, keeping the later last use.
+func ImportDir(ctx context.Context, dir string) (ImportStats, error) {
+	f, err := os.Open(filepath.Join(dir, archiveClips))
+	if err != nil {
+		slog.Error("failed to open archive", "path", dir, "error", err)
+		return ImportStats{}, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer f.Close()
+
+	records := func(yield func(clipboard.Clip, error) bool) {
+		dec := json.NewDecoder(f)
+		for {
+			var clip clipboard.Clip
+			err := dec.Decode(&clip)
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				slog.Error("failed to decode clip record", "error", err)
+				yield(clip, fmt.Errorf("invalid clip record: %w", err))
+				return
+			}
+
+			err = loadArchiveBlobs(dir, &clip)
+			if !yield(clip, err) || err != nil {
+				return
+			}
+		}
+	}
+	return ImportClips(ctx, records)
+}
+
+// ImportClips inserts the clips, e.g. read from another clipboard manager,
+// into history keeping their times. Clips already in history are deduplicated
+// as by ImportDir.
+func ImportClips(
+	ctx context.Context,
+	clips iter.Seq2[clipboard.Clip, error],
+) (ImportStats, error) {
+	var stats ImportStats
+	for clip, err := range clips {
+		if err != nil {
+			return stats, err
+		}
+
+		added, err := importClip(ctx, clip)
+		if err != nil {
+			return stats, err
+		}
+		if added {
+			stats.Imported++
+		} else {
+			stats.Duplicates++
+		}
+	}
+
+	slog.Info(
+		"clipboard history imported",
+		"imported", stats.Imported,
+		"duplicates", stats.Duplicates,
+	)
+	return stats, nil
+}
+
+// loadArchiveBlobs reads the blobs of the clip record from the archive
+// directory into clip.Blob and Representation.Data.
+func loadArchiveBlobs(dir string, clip *clipboard.Clip) error {
+	read := func(name string) ([]byte, error) {
+		if !strings.HasPrefix(name, archiveBlobs+"/") || !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("invalid blob path %q in archive", name)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			slog.Error("failed to read blob from archive", "error", err)
+			return nil, fmt.Errorf("failed to read blob from archive: %w", err)
+		}
+		return b, nil
+	}
+
+	if clip.BlobPath != "" {
+		b, err := read(clip.BlobPath)
+		if err != nil {
+			return err
+		}
+		clip.Blob = b
+	}
+
+	for i := range clip.Representations {
+		rep := &clip.Representations[i]
+		if rep.BlobPath == "" {
+			continue
+		}
+		b, err := read(rep.BlobPath)
+		if err != nil {
+			return err
+		}
+		rep.Data = b
+	}
+	return nil
+}
+
+// importClip inserts a clip read from an archive or another clipboard manager
+// keeping its times. A duplicate is merged into the existing clip: the later
+// last use is kept and the clip is pinned if either is pinned. Reports whether
+// the clip is added.
+func importClip(ctx context.Context, clip clipboard.Clip) (bool, error) {
+	clip.ID = 0
+	clip.Hash = 0
+	clip.Snippet = ""
+	// the blobs are read into Blob and Data, which are moved to the blob
+	// directory by insert
+	clip.BlobPath = ""
+	clip.BlobHash = 0
+	for i := range clip.Representations {
+		rep := &clip.Representations[i]
+		rep.ID = 0
+		rep.ClipID = 0
+		rep.BlobPath = ""
+		rep.BlobHash = 0
+	}
+
+	added := true
+	_, err := insert(
+		ctx, clip,
+		func(db *gorm.DB, dbClip clipboard.Clip) (clipboard.Clip, error) {
+			added = false
+			return merge(ctx, db, dbClip, clip)
+		},
+	)
+	return added, err
+}
+
+// merge merges the imported clip into the existing duplicate.
+func merge(
+	ctx context.Context,
+	db *gorm.DB,
+	dbClip clipboard.Clip,
+	clip clipboard.Clip,
+) (clipboard.Clip, error) {
+	var sets []clause.Assigner
+	if clip.LastUsed.After(dbClip.LastUsed) {
+		sets = append(sets, binds.Clip.LastUsed.Set(clip.LastUsed))
+		dbClip.LastUsed = clip.LastUsed
+	}
+	if clip.Pinned && !dbClip.Pinned {
+		sets = append(sets, binds.Clip.Pinned.Set(true))
+		dbClip.Pinned = true
+	}
+	if len(sets) == 0 {
+		return dbClip, nil
+	}
+
+	_, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.ID.Eq(dbClip.ID)).
+		Set(sets...).
+		Update(ctx)
+	if err != nil {
+		slog.Error("failed to merge duplicate clip", "id", dbClip.ID, "error", err)
+		return dbClip, err
+	}
+	return dbClip, nil
+}
@@ -8,25 +8,59 @@ import (
 )
 
 var Clip = struct {
+	ID              field.Number[uint]
+	Time            field.Time
+	LastUsed        field.Time
+	CopyCount       field.Number[int]
+	Selection       field.Field[clipboard.Selection]
+	Seat            field.String
+	Pinned          field.Bool
+	Hash            field.Field[clipboard.Hash]
+	Text            field.String
+	Mime            field.String
+	Metadata        field.String
+	URL             field.String
+	Blob            field.Bytes
+	BlobPath        field.String
+	BlobHash        field.Field[clipboard.Hash]
+	Representations field.Slice[clipboard.Representation]
+	Snippet         field.String
+	Sealed          field.Bool
+}{
+	ID:              field.Number[uint]{}.WithColumn("id"),
+	Time:            field.Time{}.WithColumn("time"),
+	LastUsed:        field.Time{}.WithColumn("last_used"),
+	CopyCount:       field.Number[int]{}.WithColumn("copy_count"),
+	Selection:       field.Field[clipboard.Selection]{}.WithColumn("selection"),
+	Seat:            field.String{}.WithColumn("seat"),
+	Pinned:          field.Bool{}.WithColumn("pinned"),
+	Hash:            field.Field[clipboard.Hash]{}.WithColumn("hash"),
+	Text:            field.String{}.WithColumn("text"),
+	Mime:            field.String{}.WithColumn("mime"),
+	Metadata:        field.String{}.WithColumn("metadata"),
+	URL:             field.String{}.WithColumn("url"),
+	Blob:            field.Bytes{}.WithColumn("blob"),
+	BlobPath:        field.String{}.WithColumn("blob_path"),
+	BlobHash:        field.Field[clipboard.Hash]{}.WithColumn("blob_hash"),
+	Representations: field.Slice[clipboard.Representation]{}.WithName("Representations"),
+	Snippet:         field.String{}.WithColumn("snippet"),
+	Sealed:          field.Bool{}.WithColumn("sealed"),
+}
+
+var Representation = struct {
 	ID       field.Number[uint]
-	Time     field.Time
-	Hash     field.Field[clipboard.Hash]
-	Text     field.String
+	ClipID   field.Number[uint]
 	Mime     field.String
-	Metadata field.String
-	URL      field.String
-	Blob     field.Bytes
+	Size     field.Number[int]
+	Data     field.Bytes
 	BlobPath field.String
 	BlobHash field.Field[clipboard.Hash]
 }{
 	ID:       field.Number[uint]{}.WithColumn("id"),
-	Time:     field.Time{}.WithColumn("time"),
-	Hash:     field.Field[clipboard.Hash]{}.WithColumn("hash"),
-	Text:     field.String{}.WithColumn("text"),
+	ClipID:   field.Number[uint]{}.WithColumn("clip_id"),
 	Mime:     field.String{}.WithColumn("mime"),
-	Metadata: field.String{}.WithColumn("metadata"),
-	URL:      field.String{}.WithColumn("url"),
-	Blob:     field.Bytes{}.WithColumn("blob"),
+	Size:     field.Number[int]{}.WithColumn("size"),
+	Data:     field.Bytes{}.WithColumn("data"),
 	BlobPath: field.String{}.WithColumn("blob_path"),
 	BlobHash: field.Field[clipboard.Hash]{}.WithColumn("blob_hash"),
 }
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// blobMu is held while clips are inserted or deleted, so a blob file reused by
+// a new clip isn't removed by a delete before the clip is stored.
+var blobMu sync.Mutex
+
+// BlobDir returns the directory containing the blob files.
+func BlobDir() (string, error) {
+	dbDir := viper.GetString("database")
+	if dbDir == "" {
+		slog.Error("database directory is empty")
+		return "", errors.New("database directory can not be empty")
+	}
+	return filepath.Join(dbDir, "blob"), nil
+}
+
+// SpillDir returns the directory oversized clipboard data is streamed into
+// before it is moved to the blob directory. The directory is in the runtime
+// directory if encryption is enabled, so plain data isn't written to disk.
+func SpillDir() (string, error) {
+	encrypted, err := Encrypted()
+	if err != nil {
+		return "", err
+	}
+	if encrypted {
+		return runtimePath("spill")
+	}
+
+	blobDir, err := BlobDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(blobDir, "spill"), nil
+}
+
+// createBlobDir creates the blob directory if not exists.
+func createBlobDir() (string, error) {
+	blobDir, err := BlobDir()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(blobDir, 0o700); err != nil {
+		slog.Error(
+			"failed to create blob directory",
+			"path", blobDir,
+			"error", err,
+		)
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return blobDir, nil
+}
+
+// CreateBlob create a file containing the binary files in database/blob
+// directory.
+func CreateBlob(b []byte) (clipboard.Hash, string, error) {
+	_, key, err := cipherKeys()
+	if err != nil {
+		return 0, "", err
+	}
+	h := newContentHash(key)
+	h.Write(b)
+	id := sumContentHash(h)
+
+	blobDir, err := createBlobDir()
+	if err != nil {
+		return id, "", err
+	}
+
+	path := filepath.Join(blobDir, fmt.Sprint(id))
+	if _, err := os.Stat(path); err == nil {
+		slog.Debug("blob file already exists", "path", path)
+		return id, path, nil
+	}
+
+	b, err = encryptBlob(b)
+	if err != nil {
+		slog.Error("failed to encrypt blob", "path", path, "error", err)
+		return id, path, err
+	}
+
+	err = os.WriteFile(path, b, 0o600)
+	if err != nil {
+		slog.Error("failed to write blob file", "path", path, "error", err)
+		return id, path, err
+	}
+
+	slog.Debug("blob file written", "path", path, "size", len(b))
+	return id, path, nil
+}
+
+// LoadBlob reads the blob files of the clip and its representations into
+// clip.Blob and Representation.Data.
+func LoadBlob(clip *clipboard.Clip) error {
+	if clip.BlobPath != "" {
+		b, err := readBlob(clip.BlobPath)
+		if err != nil {
+			return err
+		}
+		clip.Blob = b
+	}
+
+	for i := range clip.Representations {
+		rep := &clip.Representations[i]
+		if rep.BlobPath == "" {
+			continue
+		}
+		b, err := readBlob(rep.BlobPath)
+		if err != nil {
+			return err
+		}
+		rep.Data = b
+	}
+
+	return nil
+}
+
+func readBlob(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("failed to read blob file", "path", path, "error", err)
+		return nil, fmt.Errorf("failed to read blob file: %w", err)
+	}
+
+	b, err = decryptBlob(b)
+	if err != nil {
+		slog.Error("failed to decrypt blob file", "path", path, "error", err)
+		return nil, fmt.Errorf("failed to decrypt blob file: %w", err)
+	}
+	return b, nil
+}
+
+// AdoptBlob moves the file at given path into the blob directory. The file is
+// removed if the blob already exists. The file is read into memory to be
+// encrypted if encryption is enabled.
+func AdoptBlob(path string) (clipboard.Hash, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("failed to open file", "path", path, "error", err)
+		return 0, "", err
+	}
+
+	_, key, err := cipherKeys()
+	if err != nil {
+		file.Close()
+		return 0, "", err
+	}
+	h := newContentHash(key)
+	_, err = io.Copy(h, file)
+	file.Close()
+	if err != nil {
+		slog.Error("failed to hash file", "path", path, "error", err)
+		return 0, "", err
+	}
+	id := sumContentHash(h)
+
+	blobDir, err := createBlobDir()
+	if err != nil {
+		return id, "", err
+	}
+
+	blobPath := filepath.Join(blobDir, fmt.Sprint(id))
+	if _, err := os.Stat(blobPath); err == nil {
+		slog.Debug("blob file already exists", "path", blobPath)
+		return id, blobPath, os.Remove(path)
+	}
+
+	c, err := cipherAEAD()
+	if err != nil {
+		return id, blobPath, err
+	}
+	if c != nil {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("failed to read file", "path", path, "error", err)
+			return id, blobPath, err
+		}
+		b = append([]byte(sealedMagic), seal(c, b)...)
+		if err := writeFileAtomic(blobPath, b); err != nil {
+			slog.Error("failed to write blob file", "path", blobPath, "error", err)
+			return id, blobPath, err
+		}
+		slog.Debug("blob file encrypted", "from", path, "path", blobPath)
+		return id, blobPath, os.Remove(path)
+	}
+
+	if err := os.Rename(path, blobPath); err != nil {
+		slog.Error("failed to move blob file", "path", path, "error", err)
+		return id, blobPath, err
+	}
+
+	slog.Debug("blob file moved", "from", path, "path", blobPath)
+	return id, blobPath, nil
+}
+
+// blobRefs returns the number of clips and representations referencing the
+// blob with given hash.
+func blobRefs(
+	ctx context.Context,
+	db *gorm.DB,
+	hash clipboard.Hash,
+) (int64, error) {
+	clips, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.BlobHash.Eq(hash)).
+		Count(ctx, "*")
+	if err != nil {
+		return 0, err
+	}
+
+	reps, err := gorm.G[clipboard.Representation](db).
+		Where(binds.Representation.BlobHash.Eq(hash)).
+		Count(ctx, "*")
+	if err != nil {
+		return 0, err
+	}
+
+	return clips + reps, nil
+}
+
+// releaseBlobs removes the blob files (hash -> path) which are no longer
+// referenced by any clip or representation.
+func releaseBlobs(
+	ctx context.Context,
+	db *gorm.DB,
+	blobs map[clipboard.Hash]string,
+) error {
+	var errs []error
+	for hash, path := range blobs {
+		refs, err := blobRefs(ctx, db, hash)
+		if err != nil {
+			slog.Error(
+				"failed to count blob references",
+				"path", path,
+				"error", err,
+			)
+			errs = append(errs, err)
+			continue
+		}
+		if refs > 0 {
+			slog.Debug("blob is still referenced", "path", path, "refs", refs)
+			continue
+		}
+
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Debug("blob file removed", "path", path)
+	}
+	return errors.Join(errs...)
+}
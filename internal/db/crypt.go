@@ -0,0 +1,411 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/cespare/xxhash/v2"
+	"github.com/spf13/viper"
+)
+
+// Encryption at rest. Once enabled, the text, metadata and url of every clip
+// and every blob file are encrypted with AES-256-GCM. The key is derived from
+// a key file or a passphrase with the salt stored in crypt.json next to the
+// database. The on-disk search index is dropped, since it would contain the
+// plain text, and searches build a decrypted index in memory instead. The
+// hashes of clips and the names of blob files are keyed with a key derived
+// from the same key, so they can't be matched against known content.
+
+var (
+	// ErrLocked is returned when the history is encrypted and no key is given
+	ErrLocked = errors.New("clipboard history is locked, run yankd unlock")
+	// ErrWrongKey is returned when the given key doesn't decrypt the history
+	ErrWrongKey = errors.New("wrong key for clipboard history")
+	// ErrNoKey is returned when unlocking without key file or passphrase
+	ErrNoKey = errors.New("no key file or passphrase is given")
+)
+
+const (
+	// sealedMagic is the header of an encrypted blob file
+	sealedMagic = "YANKDENC1"
+	// cryptCheck is encrypted into the header to verify the key
+	cryptCheck = "yankd"
+
+	kdfPBKDF2 = "pbkdf2-sha256"
+	kdfHKDF   = "hkdf-sha256"
+	// pbkdf2Iterations is recommended by OWASP for PBKDF2-HMAC-SHA256
+	pbkdf2Iterations = 600_000
+)
+
+var (
+	cryptMu sync.Mutex
+	// aead is the loaded cipher, nil until the history is unlocked
+	aead cipher.AEAD
+	// hashKey is the key of the hashes of clips and blobs, derived from the
+	// key of the cipher
+	hashKey []byte
+	// aeadCache is the unlocked key file the cipher is loaded from, the cipher
+	// is forgotten when it is removed by lock
+	aeadCache string
+)
+
+// cryptHeader is the content of crypt.json
+type cryptHeader struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt"`
+	Check      []byte `json:"check"`
+}
+
+// cryptHeaderPath returns the path of crypt.json.
+func cryptHeaderPath() (string, error) {
+	dbDir := viper.GetString("database")
+	if dbDir == "" {
+		slog.Error("database directory is empty")
+		return "", errors.New("database directory can not be empty")
+	}
+	return filepath.Join(dbDir, "crypt.json"), nil
+}
+
+// readCryptHeader reads crypt.json. Returns nil header if encryption is not
+// enabled.
+func readCryptHeader() (*cryptHeader, error) {
+	path, err := cryptHeaderPath()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("failed to read crypt header", "path", path, "error", err)
+		return nil, err
+	}
+
+	var h cryptHeader
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("invalid crypt header: %w", err)
+	}
+	return &h, nil
+}
+
+// Encrypted reports whether encryption of the history is enabled.
+func Encrypted() (bool, error) {
+	h, err := readCryptHeader()
+	return h != nil, err
+}
+
+// keySecret returns the configured key file content or passphrase and the KDF
+// used for it. Returns nil if neither is configured.
+func keySecret() ([]byte, string, error) {
+	if path := viper.GetString("key-file"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("failed to read key file", "path", path, "error", err)
+			return nil, "", fmt.Errorf("failed to read key file: %w", err)
+		}
+		if len(b) == 0 {
+			return nil, "", fmt.Errorf("key file %q is empty", path)
+		}
+		return b, kdfHKDF, nil
+	}
+
+	if pass := viper.GetString("passphrase"); pass != "" {
+		return []byte(pass), kdfPBKDF2, nil
+	}
+	return nil, "", nil
+}
+
+// deriveKey derives the AES key from the secret.
+func (h *cryptHeader) deriveKey(secret []byte) ([]byte, error) {
+	switch h.KDF {
+	case kdfHKDF:
+		return hkdf.Key(sha256.New, secret, h.Salt, "yankd history", 32)
+	case kdfPBKDF2:
+		return pbkdf2.Key(sha256.New, string(secret), h.Salt, h.Iterations, 32)
+	default:
+		return nil, fmt.Errorf("unknown key derivation %q", h.KDF)
+	}
+}
+
+// newCipher creates the cipher of the key and verifies it with the header.
+func (h *cryptHeader) newCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	check, err := open(c, h.Check)
+	if err != nil || string(check) != cryptCheck {
+		return nil, ErrWrongKey
+	}
+	return c, nil
+}
+
+// useKey loads the cipher and the hash key of the key. cryptMu must be held.
+func (h *cryptHeader) useKey(key []byte, cache string) error {
+	c, err := h.newCipher(key)
+	if err != nil {
+		return err
+	}
+	hk, err := hkdf.Key(sha256.New, key, nil, "yankd hash", 32)
+	if err != nil {
+		return err
+	}
+	aead, hashKey, aeadCache = c, hk, cache
+	return nil
+}
+
+// createCryptHeader enables encryption with a key derived from the secret.
+func createCryptHeader(secret []byte, kdf string) (*cryptHeader, error) {
+	h := &cryptHeader{KDF: kdf, Salt: make([]byte, 16)}
+	if kdf == kdfPBKDF2 {
+		h.Iterations = pbkdf2Iterations
+	}
+	rand.Read(h.Salt)
+
+	key, err := h.deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	h.Check = seal(c, []byte(cryptCheck))
+
+	path, err := cryptHeaderPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		slog.Error("failed to write crypt header", "path", path, "error", err)
+		return nil, err
+	}
+
+	slog.Info("history encryption enabled", "kdf", kdf)
+	return h, nil
+}
+
+// InitializeCrypt enables encryption if a key file or passphrase is configured
+// and encrypts the plain text clips and blobs, e.g. recorded before encryption
+// was enabled. Returns ErrLocked if the history is encrypted and no key is
+// given.
+func InitializeCrypt(ctx context.Context) error {
+	h, err := readCryptHeader()
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		secret, kdf, err := keySecret()
+		if err != nil || secret == nil {
+			return err
+		}
+		if _, err := createCryptHeader(secret, kdf); err != nil {
+			return err
+		}
+	}
+
+	c, key, err := cipherKeys()
+	if err != nil || c == nil {
+		return err
+	}
+	return encryptHistory(ctx, c, key)
+}
+
+// seal encrypts b with a random nonce prepended.
+func seal(c cipher.AEAD, b []byte) []byte {
+	nonce := make([]byte, c.NonceSize(), c.NonceSize()+len(b)+c.Overhead())
+	rand.Read(nonce)
+	return c.Seal(nonce, nonce, b, nil)
+}
+
+// open decrypts b encrypted by seal.
+func open(c cipher.AEAD, b []byte) ([]byte, error) {
+	if len(b) < c.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+	nonce, b := b[:c.NonceSize()], b[c.NonceSize():]
+	return c.Open(nil, nonce, b, nil)
+}
+
+// sealString encrypts a text column. Empty string is kept empty.
+func sealString(c cipher.AEAD, s string) string {
+	if s == "" {
+		return s
+	}
+	return base64.RawStdEncoding.EncodeToString(seal(c, []byte(s)))
+}
+
+// openString decrypts a text column encrypted by sealString.
+func openString(c cipher.AEAD, s string) (string, error) {
+	if s == "" {
+		return s, nil
+	}
+
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted text: %w", err)
+	}
+	b, err = open(c, b)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt text: %w", err)
+	}
+	return string(b), nil
+}
+
+// encryptClip encrypts the text columns of the clip if encryption is enabled.
+func encryptClip(clip *clipboard.Clip) error {
+	c, err := cipherAEAD()
+	if err != nil || c == nil || clip.Sealed {
+		return err
+	}
+	clip.Text = sealString(c, clip.Text)
+	clip.Metadata = sealString(c, clip.Metadata)
+	clip.URL = sealString(c, clip.URL)
+	clip.Sealed = true
+	return nil
+}
+
+// decryptClip decrypts the text columns of the clip.
+func decryptClip(clip *clipboard.Clip) error {
+	c, err := cipherAEAD()
+	if err != nil {
+		return err
+	}
+	return openClip(c, clip)
+}
+
+// decryptClips decrypts the text columns of the clips.
+func decryptClips(clips []clipboard.Clip) error {
+	c, err := cipherAEAD()
+	if err != nil {
+		return err
+	}
+	for i := range clips {
+		if err := openClip(c, &clips[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openClip decrypts the text columns of the clip with the cipher. Plain text
+// clips are kept as is.
+func openClip(c cipher.AEAD, clip *clipboard.Clip) error {
+	if !clip.Sealed {
+		return nil
+	}
+	if c == nil {
+		return ErrLocked
+	}
+
+	var errs [3]error
+	clip.Text, errs[0] = openString(c, clip.Text)
+	clip.Metadata, errs[1] = openString(c, clip.Metadata)
+	clip.URL, errs[2] = openString(c, clip.URL)
+	if err := errors.Join(errs[:]...); err != nil {
+		slog.Error("failed to decrypt clip", "id", clip.ID, "error", err)
+		return err
+	}
+	clip.Sealed = false
+	return nil
+}
+
+// encryptBlob encrypts blob data if encryption is enabled.
+func encryptBlob(b []byte) ([]byte, error) {
+	c, err := cipherAEAD()
+	if err != nil || c == nil {
+		return b, err
+	}
+	return append([]byte(sealedMagic), seal(c, b)...), nil
+}
+
+// decryptBlob decrypts blob data. Plain data is returned as is.
+func decryptBlob(b []byte) ([]byte, error) {
+	sealed, ok := bytes.CutPrefix(b, []byte(sealedMagic))
+	if !ok {
+		return b, nil
+	}
+	c, err := cipherAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrLocked
+	}
+	return open(c, sealed)
+}
+
+// newContentHash returns the hash of clip and blob content. The hash is keyed
+// with HMAC-SHA256 if key is given, so stored hashes and blob file names don't
+// identify the content of encrypted history.
+func newContentHash(key []byte) hash.Hash {
+	if key == nil {
+		return xxhash.New()
+	}
+	return hmac.New(sha256.New, key)
+}
+
+// sumContentHash returns the sum of the hash returned by newContentHash.
+func sumContentHash(h hash.Hash) clipboard.Hash {
+	return clipboard.Hash(binary.BigEndian.Uint64(h.Sum(nil)))
+}
+
+// hashClip returns the hash of the clip, keyed if encryption is enabled.
+func hashClip(clip clipboard.Clip) (clipboard.Hash, error) {
+	_, key, err := cipherKeys()
+	if err != nil {
+		return 0, err
+	}
+	if key == nil {
+		return clipboard.HashClip(clip), nil
+	}
+	return clipboard.HashClipKeyed(key, clip), nil
+}
+
+// writeFileAtomic replaces the file at path with b.
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
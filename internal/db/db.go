@@ -8,12 +8,12 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/Nadim147c/yankd/internal/db/binds"
 	"github.com/Nadim147c/yankd/pkg/clipboard"
-	"github.com/cespare/xxhash/v2"
 	"github.com/glebarez/sqlite"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
@@ -90,11 +90,20 @@ func createDB() (*gorm.DB, error) {
 		return db, err
 	}
 
-	if err := db.AutoMigrate(&clipboard.Clip{}); err != nil {
+	err = db.AutoMigrate(&clipboard.Clip{}, &clipboard.Representation{})
+	if err != nil {
 		slog.Error("failed to auto migrate database", "error", err)
 		return nil, err
 	}
 
+	// clips recorded before last use was tracked are last used when created
+	err = db.Exec(`UPDATE clips SET last_used = time WHERE last_used IS NULL`).
+		Error
+	if err != nil {
+		slog.Error("failed to migrate last used time", "error", err)
+		return nil, err
+	}
+
 	slog.Info("database connected successfully")
 	return db, nil
 }
@@ -110,31 +119,142 @@ func Get(ctx context.Context, id uint) (clipboard.Clip, error) {
 	}
 
 	clip, err := gorm.G[clipboard.Clip](db).
+		Preload(binds.Clip.Representations.Name(), nil).
 		Where(binds.Clip.ID.Eq(id)).
 		First(ctx)
 	if err != nil {
 		slog.Error("failed to find clip", "id", id, "error", err)
 		return clipboard.Clip{}, fmt.Errorf("failed to find clip: %v", err)
 	}
+	if err := decryptClip(&clip); err != nil {
+		return clipboard.Clip{}, err
+	}
 
 	slog.Debug("successfully the clip", "id", clip.ID)
 	return clip, nil
 }
 
+// Latest returns the most recent clip of given selection. Returns error if
+// history is empty or db failure.
+func Latest(
+	ctx context.Context,
+	selection clipboard.Selection,
+) (clipboard.Clip, error) {
+	db, err := GetDB()
+	if err != nil {
+		slog.Error("failed to get database connection", "error", err)
+		return clipboard.Clip{}, err
+	}
+
+	clip, err := gorm.G[clipboard.Clip](db).
+		Preload(binds.Clip.Representations.Name(), nil).
+		Where(binds.Clip.Selection.Eq(selection)).
+		Order(binds.Clip.LastUsed.Desc()).
+		First(ctx)
+	if err != nil {
+		slog.Error("failed to find latest clip", "error", err)
+		return clipboard.Clip{}, fmt.Errorf("failed to find latest clip: %v", err)
+	}
+	if err := decryptClip(&clip); err != nil {
+		return clipboard.Clip{}, err
+	}
+
+	slog.Debug("found latest clip", "id", clip.ID)
+	return clip, nil
+}
+
+// touch marks the clip as copied again at given time.
+func touch(
+	ctx context.Context,
+	db *gorm.DB,
+	clip clipboard.Clip,
+	t time.Time,
+) (clipboard.Clip, error) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	_, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.ID.Eq(clip.ID)).
+		Set(binds.Clip.LastUsed.Set(t), binds.Clip.CopyCount.Incr(1)).
+		Update(ctx)
+	if err != nil {
+		slog.Error("failed to update last used time", "id", clip.ID, "error", err)
+		return clip, err
+	}
+
+	clip.LastUsed = t
+	clip.CopyCount++
+	slog.Debug("clip copied again", "id", clip.ID, "copy_count", clip.CopyCount)
+	return clip, nil
+}
+
+// isSpilled reports whether the representation is streamed into a file by the
+// watcher and not yet in the blob directory.
+func isSpilled(rep clipboard.Representation) bool {
+	return rep.BlobPath != "" && rep.BlobHash == 0
+}
+
+// Discard removes the files of a clip streamed by the watcher, for a clip which
+// isn't inserted.
+func Discard(clip clipboard.Clip) {
+	if clip.BlobPath != "" && clip.BlobHash == 0 {
+		os.Remove(clip.BlobPath)
+	}
+	for rep := range slices.Values(clip.Representations) {
+		if isSpilled(rep) {
+			os.Remove(rep.BlobPath)
+		}
+	}
+}
+
 // Insert inserts given clip to database. Returns error on databse failure.
 func Insert(ctx context.Context, clip clipboard.Clip) (clipboard.Clip, error) {
+	return insert(
+		ctx, clip,
+		func(db *gorm.DB, dbClip clipboard.Clip) (clipboard.Clip, error) {
+			return touch(ctx, db, dbClip, clip.Time)
+		},
+	)
+}
+
+// insert inserts the clip to database. The last use and copy count of the
+// clip are kept if set. If the clip already exists, the existing clip is
+// passed to duplicate instead.
+func insert(
+	ctx context.Context,
+	clip clipboard.Clip,
+	duplicate func(db *gorm.DB, dbClip clipboard.Clip) (clipboard.Clip, error),
+) (_ clipboard.Clip, err error) {
 	slog.Debug(
 		"inserting clip",
 		"text-size", len(clip.Text),
 		"blob-size", len(clip.Blob),
 	)
 
+	// spilled files which aren't moved into the blob directory are removed
+	// if the clip isn't stored
+	defer func() {
+		if err != nil {
+			Discard(clip)
+		}
+	}()
+
 	db, err := GetDB()
 	if err != nil {
 		slog.Error("failed to get database connection", "error", err)
 		return clip, err
 	}
 
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	// nothing is recorded while encrypted history is locked
+	if _, err := cipherAEAD(); err != nil {
+		slog.Error("failed to insert clip", "error", err)
+		return clip, err
+	}
+
 	if len(clip.Blob) != 0 {
 		blobHash, blobPath, err := CreateBlob(clip.Blob)
 		if err != nil {
@@ -146,58 +266,85 @@ func Insert(ctx context.Context, clip clipboard.Clip) (clipboard.Clip, error) {
 		clip.Blob = nil
 	}
 
-	clip.Hash = clipboard.HashClip(clip)
+	// oversized data is streamed into a file by the watcher
+	spilled := ""
+	if clip.BlobPath != "" && clip.BlobHash == 0 {
+		spilled = clip.BlobPath
+		blobHash, blobPath, err := AdoptBlob(spilled)
+		if err != nil {
+			slog.Error("failed to adopt blob", "error", err)
+			return clip, err
+		}
+		clip.BlobPath = blobPath
+		clip.BlobHash = blobHash
+	}
+
+	clip.Hash, err = hashClip(clip)
+	if err != nil {
+		return clip, err
+	}
 
 	dbClip, err := gorm.G[clipboard.Clip](db).
 		Where(binds.Clip.Hash.Eq(clip.Hash)).
 		First(ctx)
 	if err == nil {
 		slog.Debug("record already exists", "hash", clip.Hash)
-		return dbClip, nil
+		for rep := range slices.Values(clip.Representations) {
+			if isSpilled(rep) && rep.BlobPath != spilled {
+				os.Remove(rep.BlobPath)
+			}
+		}
+		if err := decryptClip(&dbClip); err != nil {
+			return dbClip, err
+		}
+		return duplicate(db, dbClip)
 	}
 
-	if err := gorm.G[clipboard.Clip](db).Create(ctx, &clip); err != nil {
-		slog.Error("failed to insert clip", "error", err)
-		return clip, err
+	if clip.LastUsed.IsZero() {
+		clip.LastUsed = clip.Time
 	}
+	clip.CopyCount = max(clip.CopyCount, 1)
 
-	slog.Debug("clip inserted successfully")
-	return clip, nil
-}
-
-// CreateBlob create a file containing the binary files in database/blob
-// directory.
-func CreateBlob(b []byte) (clipboard.Hash, string, error) {
-	id := clipboard.Hash(xxhash.Sum64(b))
-
-	dbDir := viper.GetString("database")
-	if dbDir == "" {
-		slog.Error("database directory is empty")
-		return id, "", errors.New("database directory can not be empty")
-	}
+	for i := range clip.Representations {
+		rep := &clip.Representations[i]
+		if isSpilled(*rep) {
+			if rep.BlobPath == spilled {
+				rep.BlobPath = clip.BlobPath
+				rep.BlobHash = clip.BlobHash
+				continue
+			}
+			blobHash, blobPath, err := AdoptBlob(rep.BlobPath)
+			if err != nil {
+				slog.Error("failed to adopt representation blob", "error", err)
+				return clip, err
+			}
+			rep.BlobPath = blobPath
+			rep.BlobHash = blobHash
+			continue
+		}
 
-	blobDir := filepath.Join(dbDir, "blob")
-	if err := os.MkdirAll(blobDir, 0o755); err != nil {
-		slog.Error(
-			"failed to create blob directory",
-			"path", blobDir,
-			"error", err,
-		)
-		return id, "", fmt.Errorf("failed to create blob directory: %w", err)
+		blobHash, blobPath, err := CreateBlob(rep.Data)
+		if err != nil {
+			slog.Error("failed to create representation blob", "error", err)
+			return clip, err
+		}
+		rep.BlobPath = blobPath
+		rep.BlobHash = blobHash
+		rep.Data = nil
 	}
 
-	path := filepath.Join(blobDir, fmt.Sprint(id))
-	if _, err := os.Stat(path); err == nil {
-		slog.Debug("blob file already exists", "path", path)
-		return id, path, nil
+	// the clip is returned in plain text, only the stored copy is encrypted
+	stored := clip
+	if err := encryptClip(&stored); err != nil {
+		slog.Error("failed to encrypt clip", "error", err)
+		return clip, err
 	}
-
-	err := os.WriteFile(path, b, 0o644)
-	if err != nil {
-		slog.Error("failed to write blob file", "path", path, "error", err)
-		return id, path, err
+	if err := gorm.G[clipboard.Clip](db).Create(ctx, &stored); err != nil {
+		slog.Error("failed to insert clip", "error", err)
+		return clip, err
 	}
+	clip.ID = stored.ID
 
-	slog.Debug("blob file written", "path", path, "size", len(b))
-	return id, path, nil
+	slog.Debug("clip inserted successfully")
+	return clip, nil
 }
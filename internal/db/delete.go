@@ -2,8 +2,7 @@ package db
 
 import (
 	"context"
-	"errors"
-	"os"
+	"maps"
 	"slices"
 
 	"github.com/Nadim147c/yankd/internal/db/binds"
@@ -11,20 +10,38 @@ import (
 	"gorm.io/gorm"
 )
 
-// Delete deletes a multiple from database.
+// Delete deletes a multiple from database. The blob files no longer
+// referenced are removed.
 func Delete(ctx context.Context, id []uint) (int, error) {
 	db, err := GetDB()
 	if err != nil {
 		return 0, err
 	}
 
+	blobMu.Lock()
+	defer blobMu.Unlock()
+
+	n := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		n, err = deleteClips(ctx, tx, id)
+		return err
+	})
+	return n, err
+}
+
+// deleteClips deletes the clips with their representations and blob files
+// no longer referenced. Must be called with blobMu held.
+func deleteClips(ctx context.Context, db *gorm.DB, id []uint) (int, error) {
 	clips, err := gorm.G[clipboard.Clip](db).
+		Preload(binds.Clip.Representations.Name(), nil).
 		Where(binds.Clip.ID.In(id...)).
 		Find(ctx)
 	if err != nil {
 		return 0, err
 	}
 
+	// the delete trigger removes the clips from the search index
 	n, err := gorm.G[clipboard.Clip](db).
 		Where(binds.Clip.ID.In(id...)).
 		Delete(ctx)
@@ -32,16 +49,18 @@ func Delete(ctx context.Context, id []uint) (int, error) {
 		return n, err
 	}
 
-	if err := rebuildIndex(db); err != nil {
+	_, err = gorm.G[clipboard.Representation](db).
+		Where(binds.Representation.ClipID.In(id...)).
+		Delete(ctx)
+	if err != nil {
 		return n, err
 	}
 
-	var blobErrs []error
+	// representations and other clips may share the blob with the clip
+	blobs := make(map[clipboard.Hash]string)
 	for clip := range slices.Values(clips) {
-		if clip.BlobPath != "" {
-			blobErrs = append(blobErrs, os.Remove(clip.BlobPath))
-		}
+		maps.Copy(blobs, clipBlobs(clip))
 	}
 
-	return n, errors.Join(blobErrs...)
+	return n, releaseBlobs(ctx, db, blobs)
 }
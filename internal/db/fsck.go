@@ -0,0 +1,240 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"gorm.io/gorm"
+)
+
+// staleSpillAge is the age after which a file in the spill directory is
+// considered left over by a crashed watcher
+const staleSpillAge = time.Hour
+
+// BlobProblem is the kind of problem found in the blob store
+type BlobProblem string
+
+const (
+	// BlobOrphaned is a blob file not referenced by any clip
+	BlobOrphaned BlobProblem = "orphaned"
+	// BlobMissing is a blob referenced by a clip without a file
+	BlobMissing BlobProblem = "missing"
+	// BlobMoved is a blob with a file in the blob directory under a
+	// different path than the recorded one, e.g. the database is moved
+	BlobMoved BlobProblem = "moved"
+)
+
+// BlobIssue is a problem found in the blob store
+type BlobIssue struct {
+	Problem BlobProblem `json:"problem"`
+	Path    string      `json:"path"`
+	// ClipID is the clip referencing the blob, zero for orphaned blobs
+	ClipID uint `json:"clip_id,omitempty"`
+	// RepresentationID is the representation referencing the blob, zero if the
+	// blob is referenced by the clip itself
+	RepresentationID uint `json:"representation_id,omitempty"`
+}
+
+// Fsck checks that every blob referenced by clips exists and every file in the
+// blob directory is referenced. The problems are repaired if repair is true:
+// orphaned files are removed, moved blobs are updated, clips with a missing
+// blob and representations with a missing blob are deleted.
+func Fsck(ctx context.Context, repair bool) ([]BlobIssue, error) {
+	db, err := GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	blobDir, err := BlobDir()
+	if err != nil {
+		return nil, err
+	}
+
+	clips, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.BlobPath.Neq("")).
+		Find(ctx)
+	if err != nil {
+		slog.Error("failed to get clips with blob", "error", err)
+		return nil, err
+	}
+
+	reps, err := gorm.G[clipboard.Representation](db).
+		Where(binds.Representation.BlobPath.Neq("")).
+		Find(ctx)
+	if err != nil {
+		slog.Error("failed to get representations with blob", "error", err)
+		return nil, err
+	}
+
+	var issues []BlobIssue
+	referenced := make(map[string]bool) // blob file name -> referenced
+
+	// check checks a blob reference and returns the issue found
+	check := func(path string, hash clipboard.Hash) (BlobIssue, bool) {
+		name := hash.String()
+		referenced[name] = true
+
+		if _, err := os.Stat(path); err == nil {
+			referenced[filepath.Base(path)] = true
+			return BlobIssue{}, false
+		}
+
+		expected := filepath.Join(blobDir, name)
+		if _, err := os.Stat(expected); err == nil {
+			return BlobIssue{Problem: BlobMoved, Path: expected}, true
+		}
+		return BlobIssue{Problem: BlobMissing, Path: path}, true
+	}
+
+	for clip := range slices.Values(clips) {
+		issue, ok := check(clip.BlobPath, clip.BlobHash)
+		if !ok {
+			continue
+		}
+		issue.ClipID = clip.ID
+		issues = append(issues, issue)
+	}
+
+	for rep := range slices.Values(reps) {
+		issue, ok := check(rep.BlobPath, rep.BlobHash)
+		if !ok {
+			continue
+		}
+		issue.ClipID = rep.ClipID
+		issue.RepresentationID = rep.ID
+		issues = append(issues, issue)
+	}
+
+	orphaned, err := orphanedBlobs(blobDir, referenced)
+	if err != nil {
+		return issues, err
+	}
+	for path := range slices.Values(orphaned) {
+		issues = append(issues, BlobIssue{Problem: BlobOrphaned, Path: path})
+	}
+
+	slog.Info("blob store checked", "problems", len(issues))
+	if !repair || len(issues) == 0 {
+		return issues, nil
+	}
+
+	return issues, repairBlobs(ctx, db, issues)
+}
+
+// orphanedBlobs returns the files in the blob directory which are not
+// referenced and the stale files in the spill directory.
+func orphanedBlobs(
+	blobDir string,
+	referenced map[string]bool,
+) ([]string, error) {
+	spillDir := filepath.Join(blobDir, "spill")
+
+	var orphaned []string
+	walk := func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == blobDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path == blobDir || path == spillDir {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+
+		if filepath.Dir(path) == spillDir {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// spilled data of a running watcher is still being written
+			if time.Since(info.ModTime()) > staleSpillAge {
+				orphaned = append(orphaned, path)
+			}
+			return nil
+		}
+
+		if !referenced[d.Name()] {
+			orphaned = append(orphaned, path)
+		}
+		return nil
+	}
+
+	if err := filepath.WalkDir(blobDir, walk); err != nil {
+		slog.Error(
+			"failed to walk blob directory",
+			"path", blobDir,
+			"error", err,
+		)
+		return nil, err
+	}
+	return orphaned, nil
+}
+
+// repairBlobs repairs the issues found by Fsck.
+func repairBlobs(ctx context.Context, db *gorm.DB, issues []BlobIssue) error {
+	var (
+		errs    []error
+		clipIDs []uint
+		repIDs  []uint
+	)
+
+	for issue := range slices.Values(issues) {
+		switch {
+		case issue.Problem == BlobOrphaned:
+			err := os.Remove(issue.Path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+
+		case issue.Problem == BlobMoved && issue.RepresentationID != 0:
+			_, err := gorm.G[clipboard.Representation](db).
+				Where(binds.Representation.ID.Eq(issue.RepresentationID)).
+				Set(binds.Representation.BlobPath.Set(issue.Path)).
+				Update(ctx)
+			errs = append(errs, err)
+
+		case issue.Problem == BlobMoved:
+			_, err := gorm.G[clipboard.Clip](db).
+				Where(binds.Clip.ID.Eq(issue.ClipID)).
+				Set(binds.Clip.BlobPath.Set(issue.Path)).
+				Update(ctx)
+			errs = append(errs, err)
+
+		case issue.RepresentationID != 0:
+			repIDs = append(repIDs, issue.RepresentationID)
+
+		default:
+			clipIDs = append(clipIDs, issue.ClipID)
+		}
+	}
+
+	if len(repIDs) != 0 {
+		_, err := gorm.G[clipboard.Representation](db).
+			Where(binds.Representation.ID.In(repIDs...)).
+			Delete(ctx)
+		errs = append(errs, err)
+	}
+
+	if len(clipIDs) != 0 {
+		_, err := Delete(ctx, clipIDs)
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		slog.Error("failed to repair blob store", "error", err)
+		return err
+	}
+	slog.Info("blob store repaired", "problems", len(issues))
+	return nil
+}
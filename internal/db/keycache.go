@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/cespare/xxhash/v2"
+	"github.com/spf13/viper"
+)
+
+// The key of an unlocked history is kept in the runtime directory until it is
+// locked again, so commands and the watcher don't need the key file or the
+// passphrase.
+
+// runtimePath returns the path of the named file of the database in the
+// runtime directory, which is private to the user and removed on logout.
+func runtimePath(name string) (string, error) {
+	dbDir, err := filepath.Abs(viper.GetString("database"))
+	if err != nil {
+		return "", err
+	}
+	name = fmt.Sprintf("%s-%x", name, xxhash.Sum64String(dbDir))
+	return filepath.Join(xdg.RuntimeDir, "yankd", name), nil
+}
+
+// keyCachePath returns the path the key of an unlocked history is kept at.
+func keyCachePath() (string, error) {
+	return runtimePath("key")
+}
+
+// cipherAEAD returns the cipher of the history. Returns nil if encryption is
+// not enabled and ErrLocked if no key is given.
+func cipherAEAD() (cipher.AEAD, error) {
+	c, _, err := cipherKeys()
+	return c, err
+}
+
+// cipherKeys returns the cipher and the hash key of the history. Returns nil if
+// encryption is not enabled and ErrLocked if no key is given.
+func cipherKeys() (cipher.AEAD, []byte, error) {
+	cryptMu.Lock()
+	defer cryptMu.Unlock()
+
+	if aead != nil && aeadCache != "" {
+		if _, err := os.Stat(aeadCache); err != nil {
+			slog.Info("clipboard history is locked")
+			aead, hashKey, aeadCache = nil, nil, ""
+		}
+	}
+	if aead != nil {
+		return aead, hashKey, nil
+	}
+
+	h, err := readCryptHeader()
+	if err != nil || h == nil {
+		return nil, nil, err
+	}
+
+	cache, err := keyCachePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	if key, err := os.ReadFile(cache); err == nil {
+		if err := h.useKey(key, cache); err != nil {
+			return nil, nil, err
+		}
+		return aead, hashKey, nil
+	}
+
+	secret, _, err := keySecret()
+	if err != nil {
+		return nil, nil, err
+	}
+	if secret == nil {
+		return nil, nil, ErrLocked
+	}
+	key, err := h.deriveKey(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := h.useKey(key, ""); err != nil {
+		return nil, nil, err
+	}
+	return aead, hashKey, nil
+}
+
+// Unlock verifies the configured key file or passphrase and keeps the key in
+// the runtime directory, so later commands and the watcher can use it without
+// the key. Encryption is enabled if it isn't yet.
+func Unlock(ctx context.Context) error {
+	secret, kdf, err := keySecret()
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		return ErrNoKey
+	}
+
+	h, err := readCryptHeader()
+	if err != nil {
+		return err
+	}
+	if h == nil {
+		h, err = createCryptHeader(secret, kdf)
+		if err != nil {
+			return err
+		}
+	}
+
+	key, err := h.deriveKey(secret)
+	if err != nil {
+		return err
+	}
+	if _, err := h.newCipher(key); err != nil {
+		return err
+	}
+
+	cache, err := keyCachePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cache), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(cache, key, 0o600); err != nil {
+		slog.Error("failed to write unlocked key", "path", cache, "error", err)
+		return err
+	}
+	slog.Info("clipboard history unlocked", "path", cache)
+
+	cryptMu.Lock()
+	err = h.useKey(key, cache)
+	c, hk := aead, hashKey
+	cryptMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return encryptHistory(ctx, c, hk)
+}
+
+// Lock removes the key kept by Unlock. A watcher using it stops recording
+// until the history is unlocked again.
+func Lock() error {
+	cache, err := keyCachePath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(cache)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Error("failed to remove unlocked key", "path", cache, "error", err)
+		return err
+	}
+
+	cryptMu.Lock()
+	aead, hashKey, aeadCache = nil, nil, ""
+	cryptMu.Unlock()
+
+	slog.Info("clipboard history locked")
+	return nil
+}
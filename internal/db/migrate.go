@@ -0,0 +1,253 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// encryptHistory encrypts the plain text clips and blob files, replaces their
+// hashes with keyed hashes and drops the search index containing the plain
+// text. The database is vacuumed so the plain text doesn't remain in the free
+// pages.
+func encryptHistory(ctx context.Context, c cipher.AEAD, key []byte) error {
+	db, err := GetDB()
+	if err != nil {
+		return err
+	}
+
+	if err := dropIndex(db); err != nil {
+		return err
+	}
+
+	// the hashes of clips include the hash of their blob
+	blobs, err := encryptBlobs(ctx, db, c, key)
+	if err != nil {
+		return err
+	}
+
+	clips, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.Sealed.Eq(false)).
+		Find(ctx)
+	if err != nil {
+		slog.Error("failed to get clips to encrypt", "error", err)
+		return err
+	}
+
+	encrypted := 0
+	for clip := range slices.Values(clips) {
+		hash := clipboard.HashClipKeyed(key, clip)
+		dbClip, err := gorm.G[clipboard.Clip](db).
+			Where(binds.Clip.Hash.Eq(hash)).
+			First(ctx)
+		if err == nil {
+			// recorded again after encryption was enabled
+			slog.Debug("removing plain duplicate of clip", "id", clip.ID)
+			if err := mergePlain(ctx, db, dbClip, clip); err != nil {
+				return err
+			}
+			if _, err := Delete(ctx, []uint{clip.ID}); err != nil {
+				return err
+			}
+			encrypted++
+			continue
+		}
+
+		_, err = gorm.G[clipboard.Clip](db).
+			Where(binds.Clip.ID.Eq(clip.ID)).
+			Set(
+				binds.Clip.Hash.Set(hash),
+				binds.Clip.Text.Set(sealString(c, clip.Text)),
+				binds.Clip.Metadata.Set(sealString(c, clip.Metadata)),
+				binds.Clip.URL.Set(sealString(c, clip.URL)),
+				binds.Clip.Sealed.Set(true),
+			).
+			Update(ctx)
+		if err != nil {
+			slog.Error("failed to encrypt clip", "id", clip.ID, "error", err)
+			return err
+		}
+		encrypted++
+	}
+
+	if encrypted == 0 && blobs == 0 {
+		return nil
+	}
+	slog.Info("clipboard history encrypted", "clips", encrypted, "blobs", blobs)
+
+	for _, stmt := range []string{
+		`VACUUM`,
+		`PRAGMA wal_checkpoint(TRUNCATE)`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			slog.Error("failed to vacuum database", "error", err)
+			return fmt.Errorf("failed to vacuum database: %w", err)
+		}
+	}
+	return nil
+}
+
+// mergePlain merges the use of the plain clip into its encrypted duplicate,
+// which is kept.
+func mergePlain(
+	ctx context.Context,
+	db *gorm.DB,
+	dbClip clipboard.Clip,
+	clip clipboard.Clip,
+) error {
+	sets := []clause.Assigner{
+		binds.Clip.CopyCount.Set(dbClip.CopyCount + clip.CopyCount),
+	}
+	if clip.LastUsed.After(dbClip.LastUsed) {
+		sets = append(sets, binds.Clip.LastUsed.Set(clip.LastUsed))
+	}
+	if clip.Pinned && !dbClip.Pinned {
+		sets = append(sets, binds.Clip.Pinned.Set(true))
+	}
+
+	_, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.ID.Eq(dbClip.ID)).
+		Set(sets...).
+		Update(ctx)
+	if err != nil {
+		slog.Error("failed to merge duplicate clip", "id", dbClip.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// encryptBlobs encrypts the plain blob files, renames them to their keyed
+// hash and returns the number of encrypted files.
+func encryptBlobs(
+	ctx context.Context,
+	db *gorm.DB,
+	c cipher.AEAD,
+	key []byte,
+) (int, error) {
+	blobDir, err := BlobDir()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(blobDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		slog.Error("failed to read blob directory", "path", blobDir, "error", err)
+		return 0, err
+	}
+
+	// directories and files created by older versions are readable by everyone
+	if err := os.Chmod(blobDir, 0o700); err != nil {
+		slog.Error("failed to restrict blob directory", "path", blobDir, "error", err)
+		return 0, err
+	}
+
+	n := 0
+	for entry := range slices.Values(entries) {
+		path := filepath.Join(blobDir, entry.Name())
+		mode := os.FileMode(0o600)
+		switch {
+		case entry.IsDir():
+			mode = 0o700
+		case !entry.Type().IsRegular():
+			continue
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			slog.Error("failed to restrict blob file", "path", path, "error", err)
+			return n, err
+		}
+
+		// skip the spill directory and files left by a failed write
+		if !entry.Type().IsRegular() || strings.HasSuffix(entry.Name(), ".tmp") {
+			continue
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("failed to read blob file", "path", path, "error", err)
+			return n, err
+		}
+		if bytes.HasPrefix(b, []byte(sealedMagic)) {
+			continue
+		}
+		sealed := append([]byte(sealedMagic), seal(c, b)...)
+
+		var old clipboard.Hash
+		if err := old.Scan(entry.Name()); err != nil {
+			// not a blob of any clip, fsck reports it
+			if err := writeFileAtomic(path, sealed); err != nil {
+				slog.Error("failed to encrypt blob file", "path", path, "error", err)
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		h := newContentHash(key)
+		h.Write(b)
+		hash := sumContentHash(h)
+		blobPath := filepath.Join(blobDir, hash.String())
+		if err := writeFileAtomic(blobPath, sealed); err != nil {
+			slog.Error("failed to encrypt blob file", "path", path, "error", err)
+			return n, err
+		}
+		if err := renameBlob(ctx, db, old, hash, blobPath); err != nil {
+			return n, err
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Error("failed to remove plain blob file", "path", path, "error", err)
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// renameBlob updates the references to the blob with the old hash.
+func renameBlob(
+	ctx context.Context,
+	db *gorm.DB,
+	old, hash clipboard.Hash,
+	path string,
+) error {
+	_, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.BlobHash.Eq(old)).
+		Set(binds.Clip.BlobHash.Set(hash), binds.Clip.BlobPath.Set(path)).
+		Update(ctx)
+	if err != nil {
+		slog.Error("failed to update blob of clips", "path", path, "error", err)
+		return err
+	}
+
+	_, err = gorm.G[clipboard.Representation](db).
+		Where(binds.Representation.BlobHash.Eq(old)).
+		Set(
+			binds.Representation.BlobHash.Set(hash),
+			binds.Representation.BlobPath.Set(path),
+		).
+		Update(ctx)
+	if err != nil {
+		slog.Error(
+			"failed to update blob of representations",
+			"path", path,
+			"error", err,
+		)
+		return err
+	}
+	return nil
+}
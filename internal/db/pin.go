@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"gorm.io/gorm"
+)
+
+// Pin pins or unpins clips. Pinned clips are never pruned.
+func Pin(ctx context.Context, id []uint, pinned bool) (int, error) {
+	db, err := GetDB()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := gorm.G[clipboard.Clip](db).
+		Where(binds.Clip.ID.In(id...)).
+		Set(binds.Clip.Pinned.Set(pinned)).
+		Update(ctx)
+	if err != nil {
+		slog.Error("failed to update pinned", "error", err)
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/db/binds"
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"gorm.io/gorm"
+)
+
+// Retention limits the clipboard history. Pinned clips are exempt and don't
+// count towards the limits. Zero values are unlimited.
+type Retention struct {
+	// MaxItems is the max number of clips kept
+	MaxItems int
+	// MaxAge is the max time since clips kept were last used
+	MaxAge time.Duration
+	// MaxBlobSize is the max total size of blobs in bytes
+	MaxBlobSize int64
+}
+
+// IsZero reports whether retention has no limits.
+func (r Retention) IsZero() bool {
+	return r == Retention{}
+}
+
+// Prune deletes the least recently used clips exceeding the retention limits.
+// Returns the ids of the deleted clips.
+func Prune(ctx context.Context, r Retention) ([]uint, error) {
+	if r.IsZero() {
+		return nil, nil
+	}
+
+	db, err := GetDB()
+	if err != nil {
+		return nil, err
+	}
+
+	clips, err := gorm.G[clipboard.Clip](db).
+		Preload(binds.Clip.Representations.Name(), nil).
+		Where(binds.Clip.Pinned.Eq(false)).
+		Order(binds.Clip.LastUsed.Desc()).
+		Find(ctx)
+	if err != nil {
+		slog.Error("failed to get clips to prune", "error", err)
+		return nil, err
+	}
+
+	// blobs are shared by hash, each is counted once. Blobs of pinned clips
+	// don't count and aren't freed by pruning.
+	counted := make(map[clipboard.Hash]bool)
+	if r.MaxBlobSize > 0 {
+		pinned, err := gorm.G[clipboard.Clip](db).
+			Preload(binds.Clip.Representations.Name(), nil).
+			Where(binds.Clip.Pinned.Eq(true)).
+			Find(ctx)
+		if err != nil {
+			slog.Error("failed to get pinned clips", "error", err)
+			return nil, err
+		}
+		for clip := range slices.Values(pinned) {
+			for hash := range clipBlobs(clip) {
+				counted[hash] = true
+			}
+		}
+	}
+
+	var (
+		ids      []uint
+		blobSize int64
+		oldest   = time.Now().Add(-r.MaxAge)
+	)
+	for i, clip := range clips {
+		if r.MaxItems > 0 && i >= r.MaxItems {
+			ids = append(ids, clip.ID)
+			continue
+		}
+		if r.MaxAge > 0 && clip.LastUsed.Before(oldest) {
+			ids = append(ids, clip.ID)
+			continue
+		}
+		if r.MaxBlobSize > 0 {
+			// only the blobs not kept by a more recent clip add to the size
+			blobs := clipBlobs(clip)
+			maps.DeleteFunc(blobs, func(hash clipboard.Hash, _ string) bool {
+				return counted[hash]
+			})
+			size := blobsSize(blobs)
+			if blobSize+size > r.MaxBlobSize {
+				ids = append(ids, clip.ID)
+				continue
+			}
+			blobSize += size
+			for hash := range blobs {
+				counted[hash] = true
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		slog.Debug("nothing to prune")
+		return nil, nil
+	}
+
+	n, err := Delete(ctx, ids)
+	if n == 0 {
+		return nil, err
+	}
+	if err != nil {
+		return ids, err
+	}
+	slog.Info("clipboard history pruned", "deleted-items", n)
+	return ids, nil
+}
+
+// clipBlobs returns the blobs (hash -> path) of a clip and its
+// representations.
+func clipBlobs(clip clipboard.Clip) map[clipboard.Hash]string {
+	blobs := make(map[clipboard.Hash]string)
+	if clip.BlobPath != "" {
+		blobs[clip.BlobHash] = clip.BlobPath
+	}
+	for rep := range slices.Values(clip.Representations) {
+		if rep.BlobPath != "" {
+			blobs[rep.BlobHash] = rep.BlobPath
+		}
+	}
+	return blobs
+}
+
+// blobsSize returns the total size of the blob files.
+func blobsSize(blobs map[clipboard.Hash]string) int64 {
+	var size int64
+	for path := range maps.Values(blobs) {
+		info, err := os.Stat(path)
+		if err != nil {
+			slog.Debug("failed to stat blob", "path", path, "error", err)
+			continue
+		}
+		size += info.Size()
+	}
+	return size
+}
@@ -0,0 +1,343 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Nadim147c/yankd/internal/config"
+)
+
+// Query is a parsed search query. A query is a list of whitespace separated
+// terms and filters, all of which must match:
+//
+//	hello            text, url or metadata with a word starting with hello
+//	"hello world"    the exact phrase
+//	mime:image/*     mime type matching the glob pattern
+//	before:2026-01-01, after:3d
+//	                 last used before or after a date or a duration ago (s, m,
+//	                 h, d, w)
+//	has:url          clips with url, blob, text or metadata
+//	id:>100          id compared with >, >=, <, <= or =, or a range 10..20
+//	selection:primary, seat:seat0, is:pinned
+//
+// Any term or filter is negated with a leading -, e.g. -mime:text/html.
+type Query struct {
+	Terms   []Term
+	Filters []Filter
+}
+
+// Term is a full text search term
+type Term struct {
+	Text   string
+	Phrase bool // quoted, matched exactly instead of as a prefix
+	Negate bool
+}
+
+// Filter is a field filter of a query
+type Filter struct {
+	Field  string
+	Value  string
+	Negate bool
+}
+
+// queryFields are the fields which can be filtered
+var queryFields = []string{
+	"mime", "before", "after", "has", "id", "selection", "seat", "is",
+}
+
+// ParseQuery parses a search query.
+func ParseQuery(s string) (Query, error) {
+	var q Query
+	tokens, err := tokenize(s)
+	if err != nil {
+		return q, err
+	}
+
+	for _, tok := range tokens {
+		negate := false
+		if len(tok) > 1 && tok[0] == '-' {
+			negate = true
+			tok = tok[1:]
+		}
+
+		field, value, ok := strings.Cut(tok, ":")
+		if ok && !strings.HasPrefix(field, `"`) && isQueryField(field) {
+			value = unquote(value)
+			if value == "" {
+				return q, fmt.Errorf("empty value for filter %q", field)
+			}
+			filter := Filter{
+				Field:  strings.ToLower(field),
+				Value:  value,
+				Negate: negate,
+			}
+			if _, _, err := filter.sql(); err != nil {
+				return q, err
+			}
+			q.Filters = append(q.Filters, filter)
+			continue
+		}
+
+		text := unquote(tok)
+		if text == "" {
+			continue
+		}
+		q.Terms = append(q.Terms, Term{
+			Text:   text,
+			Phrase: strings.Contains(tok, `"`),
+			Negate: negate,
+		})
+	}
+
+	return q, nil
+}
+
+func isQueryField(field string) bool {
+	for _, f := range queryFields {
+		if strings.EqualFold(f, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize splits s by whitespace outside of double quotes. The quotes are
+// kept in the tokens.
+func tokenize(s string) ([]string, error) {
+	var (
+		tokens []string
+		tok    strings.Builder
+		quoted bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			tok.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if tok.Len() != 0 {
+				tokens = append(tokens, tok.String())
+				tok.Reset()
+			}
+		default:
+			tok.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote in query")
+	}
+	if tok.Len() != 0 {
+		tokens = append(tokens, tok.String())
+	}
+	return tokens, nil
+}
+
+// unquote removes the double quotes from s.
+func unquote(s string) string {
+	return strings.ReplaceAll(s, `"`, "")
+}
+
+// HasText reports whether the query has full text terms.
+func (q Query) HasText() bool {
+	return len(q.Terms) != 0
+}
+
+// Match returns the FTS5 expression of the full text terms which are matched
+// together with the FTS index of given tokenizer. Empty expression means no
+// term is matched with it.
+func (q Query) Match(tokenizer string) string {
+	// FTS5 doesn't allow a query to start with NOT, so negated terms are
+	// compiled to separate conditions by Where
+	var match []string
+	for _, t := range q.Terms {
+		if !t.Negate && t.indexed(tokenizer) {
+			match = append(match, t.fts(tokenizer))
+		}
+	}
+	return strings.Join(match, " ")
+}
+
+// Where compiles the query to a parameterized SQL condition on the clips
+// table, except the terms returned by Match. Other terms are matched with the
+// FTS index of given tokenizer, or with LIKE if tokenizer is empty. Empty
+// condition matches every clip.
+func (q Query) Where(tokenizer string) (string, []any, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(negate bool, cond string, values ...any) {
+		cond = "(" + cond + ")"
+		if negate {
+			cond = "NOT " + cond
+		}
+		conds = append(conds, cond)
+		args = append(args, values...)
+	}
+
+	for _, f := range q.Filters {
+		cond, values, err := f.sql()
+		if err != nil {
+			return "", nil, err
+		}
+		add(f.Negate, cond, values...)
+	}
+
+	for _, t := range q.Terms {
+		switch {
+		case !t.indexed(tokenizer):
+			like := "%" + escapeLike(t.Text) + "%"
+			add(t.Negate, likeCond, like, like, like)
+		case t.Negate:
+			add(true, ftsCond, t.fts(tokenizer))
+		}
+	}
+
+	return strings.Join(conds, " AND "), args, nil
+}
+
+const (
+	ftsCond = `clips.id IN ` +
+		`(SELECT rowid FROM clip_index WHERE clip_index MATCH ?)`
+	likeCond = `clips.text LIKE ? ESCAPE '\' OR ` +
+		`clips.metadata LIKE ? ESCAPE '\' OR ` +
+		`clips.url LIKE ? ESCAPE '\'`
+)
+
+// indexed reports whether the term can be matched with the FTS index of
+// given tokenizer. Trigram index can't match terms shorter than 3 characters.
+func (t Term) indexed(tokenizer string) bool {
+	switch tokenizer {
+	case "":
+		return false
+	case config.TokenizerTrigram:
+		return utf8.RuneCountInString(t.Text) >= 3
+	default:
+		return true
+	}
+}
+
+// fts returns the term as an escaped FTS5 string. Words are matched as prefix
+// unless trigram tokenizer is used, which matches substrings.
+func (t Term) fts(tokenizer string) string {
+	s := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+	if !t.Phrase && tokenizer != config.TokenizerTrigram {
+		s += "*"
+	}
+	return s
+}
+
+// escapeLike escapes the wildcards of LIKE with \.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// sql compiles the filter to a parameterized SQL condition.
+func (f Filter) sql() (string, []any, error) {
+	switch f.Field {
+	case "mime":
+		return "clips.mime GLOB ?", []any{f.Value}, nil
+	case "selection":
+		return "clips.selection = ?", []any{strings.ToLower(f.Value)}, nil
+	case "seat":
+		return "clips.seat = ?", []any{f.Value}, nil
+	case "is":
+		if !strings.EqualFold(f.Value, "pinned") {
+			return "", nil, fmt.Errorf("invalid is filter %q", f.Value)
+		}
+		return "clips.pinned", nil, nil
+	case "has":
+		column, ok := map[string]string{
+			"url":      "url",
+			"blob":     "blob_path",
+			"text":     "text",
+			"metadata": "metadata",
+		}[strings.ToLower(f.Value)]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid has filter %q", f.Value)
+		}
+		return "COALESCE(clips." + column + ", '') != ''", nil, nil
+	case "before", "after":
+		t, err := parseQueryTime(f.Value, time.Now())
+		if err != nil {
+			return "", nil, err
+		}
+		// last_used is stored as text with the offset of the local time zone,
+		// which doesn't compare as text with other time zones
+		if f.Field == "before" {
+			return "unixepoch(clips.last_used) < ?", []any{t.Unix()}, nil
+		}
+		return "unixepoch(clips.last_used) > ?", []any{t.Unix()}, nil
+	case "id":
+		return idCond(f.Value)
+	default:
+		return "", nil, fmt.Errorf("unknown filter %q", f.Field)
+	}
+}
+
+// idCond compiles an id filter: N, =N, >N, >=N, <N, <=N or N..M.
+func idCond(value string) (string, []any, error) {
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		lo, err := strconv.ParseUint(from, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid id range %q", value)
+		}
+		hi, err := strconv.ParseUint(to, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid id range %q", value)
+		}
+		return "clips.id BETWEEN ? AND ?", []any{lo, hi}, nil
+	}
+
+	op := "="
+	for _, o := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(value, o); ok {
+			op, value = o, rest
+			break
+		}
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid id %q", value)
+	}
+	return "clips.id " + op + " ?", []any{id}, nil
+}
+
+// queryUnits are the units of relative times in addition to time.Duration
+var queryUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// parseQueryTime parses a date, a date time or a duration before now.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02T15:04",
+		time.DateOnly,
+	} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	unit, ok := queryUnits[s[len(s)-1]]
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return now.Add(-time.Duration(n * float64(unit))), nil
+}
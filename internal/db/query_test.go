@@ -0,0 +1,249 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/config"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Query
+	}{
+		{query: "", want: Query{}},
+		{
+			query: "hello  world",
+			want: Query{Terms: []Term{
+				{Text: "hello"},
+				{Text: "world"},
+			}},
+		},
+		{
+			query: `"hello world" -foo`,
+			want: Query{Terms: []Term{
+				{Text: "hello world", Phrase: true},
+				{Text: "foo", Negate: true},
+			}},
+		},
+		{
+			query: `-mime:text/html MIME:image/* seat:"seat 0"`,
+			want: Query{Filters: []Filter{
+				{Field: "mime", Value: "text/html", Negate: true},
+				{Field: "mime", Value: "image/*"},
+				{Field: "seat", Value: "seat 0"},
+			}},
+		},
+		{
+			query: "id:>100 is:pinned has:url selection:primary",
+			want: Query{Filters: []Filter{
+				{Field: "id", Value: ">100"},
+				{Field: "is", Value: "pinned"},
+				{Field: "has", Value: "url"},
+				{Field: "selection", Value: "primary"},
+			}},
+		},
+		{
+			// unknown fields and quoted colons are searched as text
+			query: `foo:bar "mime:x"`,
+			want: Query{Terms: []Term{
+				{Text: "foo:bar"},
+				{Text: "mime:x", Phrase: true},
+			}},
+		},
+		{
+			query: `- "" -`,
+			want: Query{Terms: []Term{
+				{Text: "-"},
+				{Text: "-"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	for _, query := range []string{
+		`"unterminated`,
+		"mime:",
+		`mime:""`,
+		"is:unpinned",
+		"has:nothing",
+		"id:abc",
+		"id:10..x",
+		"before:yesterday",
+		"after:3y",
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) succeeded, want error", query)
+		}
+	}
+}
+
+func TestQueryWhere(t *testing.T) {
+	tests := []struct {
+		query     string
+		tokenizer string
+		match     string
+		where     string
+		args      []any
+	}{
+		{
+			query:     "hello -world",
+			tokenizer: config.TokenizerUnicode,
+			match:     `"hello"*`,
+			where:     "NOT (" + ftsCond + ")",
+			args:      []any{`"world"*`},
+		},
+		{
+			query:     `"hello world"`,
+			tokenizer: config.TokenizerUnicode,
+			match:     `"hello world"`,
+		},
+		{
+			query:     "hello ab",
+			tokenizer: config.TokenizerTrigram,
+			match:     `"hello"`,
+			where:     "(" + likeCond + ")",
+			args:      []any{"%ab%", "%ab%", "%ab%"},
+		},
+		{
+			query: "100%",
+			where: "(" + likeCond + ")",
+			args:  []any{`%100\%%`, `%100\%%`, `%100\%%`},
+		},
+		{
+			query: "id:10..20 -id:<=12",
+			where: "(clips.id BETWEEN ? AND ?) AND NOT (clips.id <= ?)",
+			args:  []any{uint64(10), uint64(20), uint64(12)},
+		},
+		{
+			query: "selection:PRIMARY has:blob",
+			where: "(clips.selection = ?) AND " +
+				"(COALESCE(clips.blob_path, '') != '')",
+			args: []any{"primary"},
+		},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error: %v", tt.query, err)
+		}
+		if got := q.Match(tt.tokenizer); got != tt.match {
+			t.Errorf("%q: Match() = %q, want %q", tt.query, got, tt.match)
+		}
+		where, args, err := q.Where(tt.tokenizer)
+		if err != nil {
+			t.Fatalf("%q: Where() error: %v", tt.query, err)
+		}
+		if where != tt.where {
+			t.Errorf("%q: Where() = %q, want %q", tt.query, where, tt.where)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: Where() args = %v, want %v", tt.query, args, tt.args)
+		}
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2026-01-02", time.Date(2026, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2026-01-02T15:04", time.Date(2026, 1, 2, 15, 4, 0, 0, time.Local)},
+		{
+			"2026-01-02T15:04:05Z",
+			time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC),
+		},
+		{"90m", now.Add(-90 * time.Minute)},
+		{"3d", now.Add(-3 * 24 * time.Hour)},
+		{"1.5w", now.Add(-252 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseQueryTime(tt.value, now)
+		if err != nil {
+			t.Errorf("parseQueryTime(%q) error: %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseQueryTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTimeZones(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(
+		"CREATE TABLE clips (id INTEGER PRIMARY KEY, last_used DATETIME)",
+	).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// the same instant stored with different offsets, and an hour later
+	instant := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	east := time.FixedZone("east", 6*60*60)
+	west := time.FixedZone("west", -5*60*60)
+	for id, lastUsed := range []time.Time{
+		instant,
+		instant.In(east),
+		instant.In(west),
+		instant.Add(time.Hour).In(west),
+	} {
+		if err := db.Exec(
+			"INSERT INTO clips VALUES (?, ?)", id+1, lastUsed,
+		).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []uint
+	}{
+		{"before:2026-01-02T12:30:00Z", []uint{1, 2, 3}},
+		{"after:2026-01-02T12:30:00Z", []uint{4}},
+		{"after:2026-01-02T17:30:00+06:00", []uint{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error: %v", tt.query, err)
+		}
+		where, args, err := q.Where("")
+		if err != nil {
+			t.Fatalf("%q: Where() error: %v", tt.query, err)
+		}
+
+		var ids []uint
+		err = db.Raw(
+			"SELECT id FROM clips WHERE "+where+" ORDER BY id", args...,
+		).Scan(&ids).Error
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%q: ids = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+}
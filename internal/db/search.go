@@ -2,15 +2,56 @@ package db
 
 import (
 	"context"
+	"crypto/cipher"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
+	"github.com/Nadim147c/yankd/internal/config"
 	"github.com/Nadim147c/yankd/internal/db/binds"
 	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/spf13/viper"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// InitializeFTS sets up the FTS5 virtual table and triggers
+// configuredTokenizer returns the tokenizer of the search index set in config.
+func configuredTokenizer() (string, error) {
+	switch t := viper.GetString("fts-tokenizer"); t {
+	case "", config.TokenizerUnicode:
+		return config.TokenizerUnicode, nil
+	case config.TokenizerTrigram:
+		return config.TokenizerTrigram, nil
+	default:
+		return "", fmt.Errorf("invalid fts tokenizer: %q", t)
+	}
+}
+
+// indexTokenizer returns the tokenizer of the existing search index, or empty
+// string if the index doesn't exist.
+func indexTokenizer(db *gorm.DB) (string, error) {
+	var schema string
+	err := db.Raw(`SELECT COALESCE(MAX(sql), '') FROM sqlite_master
+    WHERE type = 'table' AND name = 'clip_index'`).
+		Scan(&schema).Error
+	if err != nil {
+		slog.Error("failed to get FTS5 table schema", "error", err)
+		return "", err
+	}
+
+	switch {
+	case schema == "":
+		return "", nil
+	case strings.Contains(schema, config.TokenizerTrigram):
+		return config.TokenizerTrigram, nil
+	default:
+		return config.TokenizerUnicode, nil
+	}
+}
+
+// InitializeFTS sets up the FTS5 virtual table and triggers. The index is
+// rebuilt if the configured tokenizer has changed.
 func InitializeFTS() error {
 	slog.Debug("Initializing FTS5")
 
@@ -19,36 +60,90 @@ func InitializeFTS() error {
 		return err
 	}
 
+	tokenizer, err := configuredTokenizer()
+	if err != nil {
+		return err
+	}
+
+	// the index of encrypted history is built in memory when searching
+	encrypted, err := Encrypted()
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return dropIndex(db)
+	}
+
+	current, err := indexTokenizer(db)
+	if err != nil {
+		return err
+	}
+
+	rebuild := current != "" && current != tokenizer
+	if rebuild {
+		slog.Info(
+			"FTS5 tokenizer changed, rebuilding index",
+			"from", current,
+			"to", tokenizer,
+		)
+		if err := db.Exec(`DROP TABLE clip_index`).Error; err != nil {
+			slog.Error("failed to drop FTS5 table", "error", err)
+			return fmt.Errorf("failed to drop FTS5 table: %w", err)
+		}
+	}
+
 	// Create FTS5 virtual table for clips
-	if err := db.Exec(`
+	if err := db.Exec(fmt.Sprintf(`
     CREATE VIRTUAL TABLE IF NOT EXISTS clip_index USING FTS5(
 			text,
 			url,
 			metadata,
 			content='clips',
-			content_rowid='id'
+			content_rowid='id',
+			tokenize='%s'
     );
-    `).Error; err != nil {
+    `, tokenizer)).Error; err != nil {
 		slog.Error("failed to create FTS5 table", "error", err)
 		return fmt.Errorf("failed to create FTS5 table: %w", err)
 	}
-	slog.Debug("FTS5 table created")
+	slog.Debug("FTS5 table created", "tokenizer", tokenizer)
+
+	// triggers of older versions deleted rows from the external content index
+	// with DELETE, which leaves the tokens of the old row in the index
+	outdated, err := outdatedTriggers(db)
+	if err != nil {
+		return err
+	}
+	if outdated {
+		slog.Info("FTS5 triggers are outdated, rebuilding index")
+		rebuild = true
+	}
 
-	// Create triggers to keep index in sync
+	// Create triggers to keep index in sync. The old row is removed from the
+	// index with the delete command, as the content table has already changed.
+	for _, name := range []string{"clip_ai", "clip_au", "clip_ad"} {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+			slog.Error("failed to drop trigger", "trigger", name, "error", err)
+			return fmt.Errorf("failed to drop trigger: %w", err)
+		}
+	}
 	triggers := []string{
 		// Insert
-		`CREATE TRIGGER IF NOT EXISTS clip_ai AFTER INSERT ON clips BEGIN
+		`CREATE TRIGGER clip_ai AFTER INSERT ON clips BEGIN
             INSERT INTO clip_index(rowid, text, url, metadata)
             VALUES (new.id, new.text, new.url, new.metadata);
         END;`,
 		// Update
-		`CREATE TRIGGER IF NOT EXISTS clip_au AFTER UPDATE ON clips BEGIN
-            UPDATE clip_index SET text=new.text, url=new.url, metadata=new.metadata
-            WHERE rowid=new.id;
+		`CREATE TRIGGER clip_au AFTER UPDATE ON clips BEGIN
+            INSERT INTO clip_index(clip_index, rowid, text, url, metadata)
+            VALUES ('delete', old.id, old.text, old.url, old.metadata);
+            INSERT INTO clip_index(rowid, text, url, metadata)
+            VALUES (new.id, new.text, new.url, new.metadata);
         END;`,
 		// Delete
-		`CREATE TRIGGER IF NOT EXISTS clip_ad AFTER DELETE ON clips BEGIN
-            DELETE FROM clip_index WHERE rowid=old.id;
+		`CREATE TRIGGER clip_ad AFTER DELETE ON clips BEGIN
+            INSERT INTO clip_index(clip_index, rowid, text, url, metadata)
+            VALUES ('delete', old.id, old.text, old.url, old.metadata);
         END;`,
 	}
 
@@ -60,14 +155,53 @@ func InitializeFTS() error {
 	}
 	slog.Debug("FTS5 triggers created", "count", len(triggers))
 
+	if rebuild {
+		return rebuildIndex(db)
+	}
+	return nil
+}
+
+// outdatedTriggers reports whether the delete trigger of the index removes rows
+// with DELETE instead of the delete command.
+func outdatedTriggers(db *gorm.DB) (bool, error) {
+	var trigger string
+	err := db.Raw(`SELECT COALESCE(MAX(sql), '') FROM sqlite_master
+    WHERE type = 'trigger' AND name = 'clip_ad'`).
+		Scan(&trigger).Error
+	if err != nil {
+		slog.Error("failed to get FTS5 trigger", "error", err)
+		return false, err
+	}
+	return trigger != "" && !strings.Contains(trigger, "'delete'"), nil
+}
+
+// dropIndex drops the FTS index and its triggers.
+func dropIndex(db *gorm.DB) error {
+	for _, stmt := range []string{
+		`DROP TRIGGER IF EXISTS clip_ai`,
+		`DROP TRIGGER IF EXISTS clip_au`,
+		`DROP TRIGGER IF EXISTS clip_ad`,
+		`DROP TABLE IF EXISTS clip_index`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			slog.Error("failed to drop FTS index", "error", err)
+			return fmt.Errorf("failed to drop FTS index: %w", err)
+		}
+	}
 	return nil
 }
 
-// rebuildIndex rebuilds the FTS index for all existing rows
+// rebuildIndex rebuilds the FTS index for all existing rows. Nothing is done if
+// the index doesn't exist, e.g. history is encrypted.
 func rebuildIndex(db *gorm.DB) error {
+	tokenizer, err := indexTokenizer(db)
+	if err != nil || tokenizer == "" {
+		return err
+	}
+
 	slog.Debug("rebuilding FTS index")
 
-	err := db.Exec("INSERT INTO clip_index(clip_index) VALUES('rebuild')").Error
+	err = db.Exec("INSERT INTO clip_index(clip_index) VALUES('rebuild')").Error
 	if err != nil {
 		slog.Error("failed to rebuild FTS index", "error", err)
 		return err
@@ -77,14 +211,32 @@ func rebuildIndex(db *gorm.DB) error {
 	return nil
 }
 
-// Search searches runs full-text serach in database and returns matched items.
+// selectionCond returns condition matching clips of given selection. Empty
+// selection matches clips of all selections.
+func selectionCond(selection clipboard.Selection) clause.Expression {
+	if selection == "" {
+		return clause.Expr{SQL: "1 = 1"}
+	}
+	return binds.Clip.Selection.Eq(selection)
+}
+
+// Search parses the query (see Query) and returns the matched clips, the most
+// recently used first. Full text terms are searched with the FTS index, falling
+// back to substring match if nothing is found.
 func Search(
 	ctx context.Context,
 	query string,
 	limit int,
 	sync bool,
+	selection clipboard.Selection,
 ) ([]clipboard.Clip, error) {
-	slog.Debug("searching clips", "query", query)
+	slog.Debug("searching clips", "query", query, "selection", selection)
+
+	q, err := ParseQuery(query)
+	if err != nil {
+		slog.Error("failed to parse query", "query", query, "error", err)
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
 
 	db, err := GetDB()
 	if err != nil {
@@ -92,11 +244,37 @@ func Search(
 		return nil, err
 	}
 
-	if query == "" {
-		return gorm.G[clipboard.Clip](db).
-			Order(binds.Clip.Time.Desc()).
-			Limit(limit).
-			Find(ctx)
+	c, err := cipherAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	if !q.HasText() {
+		clips, err := search(ctx, db, q, "", limit, selection)
+		if err != nil {
+			return nil, err
+		}
+		return clips, decryptClips(clips)
+	}
+
+	if c != nil {
+		var clips []clipboard.Clip
+		err := db.Transaction(func(tx *gorm.DB) error {
+			tokenizer, err := memoryIndex(ctx, tx, c)
+			if err != nil {
+				return err
+			}
+			defer dropMemoryIndex(tx)
+
+			clips, err = searchText(ctx, tx, q, tokenizer, limit, selection)
+			return err
+		})
+		return clips, err
+	}
+
+	tokenizer, err := indexTokenizer(db)
+	if err != nil {
+		return nil, err
 	}
 
 	if sync {
@@ -106,61 +284,172 @@ func Search(
 		}
 	}
 
-	slog.Debug("starting flexible search", "query", query)
-
-	var clips []clipboard.Clip
-	ftsQuery := fmt.Sprintf(
-		"%s* OR metadata:%s* OR url:%s*",
-		query, query, query,
-	)
-
-	// Try FTS5 search first
-	err = db.WithContext(ctx).Raw(`SELECT clips.* FROM clips
-    JOIN clip_index ON clip_index.rowid = clips.id
-    WHERE clip_index MATCH ?
-    ORDER BY rank
-    LIMIT ?
-    `, ftsQuery, limit).
-		Scan(&clips).Error
+	return searchText(ctx, db, q, tokenizer, limit, selection)
+}
 
+// searchText finds clips matching the query with full text terms. The terms
+// are matched with the FTS index of given tokenizer, falling back to substring
+// match if nothing is found.
+func searchText(
+	ctx context.Context,
+	db *gorm.DB,
+	q Query,
+	tokenizer string,
+	limit int,
+	selection clipboard.Selection,
+) ([]clipboard.Clip, error) {
+	clips, err := search(ctx, db, q, tokenizer, limit, selection)
 	if err == nil && len(clips) > 0 {
-		slog.Debug(
-			"FTS5 search succeeded",
-			"query", query,
-			"results", len(clips),
-		)
+		slog.Debug("FTS5 search succeeded", "results", len(clips))
 		return clips, nil
 	}
 
 	if err != nil {
-		slog.Debug(
-			"FTS5 search failed, falling back to LIKE",
-			"query", query,
-			"error", err,
-		)
+		slog.Debug("FTS5 search failed, falling back to LIKE", "error", err)
 	} else {
-		slog.Debug(
-			"FTS5 search returned no results, falling back to LIKE",
-			"query", query,
-		)
+		slog.Debug("FTS5 search returned no results, falling back to LIKE")
 	}
 
-	// Fallback to normal LIKE search
-	likeQuery := "%" + query + "%"
-	if err := db.WithContext(ctx).
-		Where(binds.Clip.Text.Like(likeQuery)).
-		Or(binds.Clip.Metadata.Like(likeQuery)).
-		Or(binds.Clip.URL.Like(likeQuery)).
-		Limit(limit).
-		Find(&clips).Error; err != nil {
-		slog.Error("fallback LIKE search failed", "query", query, "error", err)
+	clips, err = search(ctx, db, q, "", limit, selection)
+	if err != nil {
+		slog.Error("fallback LIKE search failed", "error", err)
+		return nil, err
+	}
+
+	slog.Debug("fallback LIKE search succeeded", "results", len(clips))
+	return clips, nil
+}
+
+// memoryIndex creates a decrypted copy of the clips table and its FTS index in
+// the temp schema of the connection, which is kept in memory. The temp tables
+// shadow the encrypted ones in the queries of the connection. Returns the
+// tokenizer of the index.
+func memoryIndex(
+	ctx context.Context,
+	tx *gorm.DB,
+	c cipher.AEAD,
+) (string, error) {
+	tokenizer, err := configuredTokenizer()
+	if err != nil {
+		return "", err
+	}
+
+	var schema string
+	err = tx.Raw(`SELECT sql FROM main.sqlite_master
+    WHERE type = 'table' AND name = 'clips'`).
+		Scan(&schema).Error
+	if err != nil {
+		slog.Error("failed to get clips table schema", "error", err)
+		return "", err
+	}
+
+	stmts := []string{
+		`PRAGMA temp_store = MEMORY`,
+		strings.Replace(schema, "CREATE TABLE", "CREATE TEMP TABLE", 1),
+		`INSERT INTO temp.clips SELECT * FROM main.clips`,
+	}
+	for _, stmt := range stmts {
+		if err := tx.Exec(stmt).Error; err != nil {
+			slog.Error("failed to copy clips into memory", "error", err)
+			return "", err
+		}
+	}
+
+	clips, err := gorm.G[clipboard.Clip](tx).
+		Select("id", "text", "metadata", "url", "sealed").
+		Where(binds.Clip.Sealed.Eq(true)).
+		Find(ctx)
+	if err != nil {
+		return "", err
+	}
+	for clip := range slices.Values(clips) {
+		if err := openClip(c, &clip); err != nil {
+			return "", err
+		}
+
+		err = tx.Exec(
+			`UPDATE temp.clips SET text = ?, metadata = ?, url = ?, sealed = ?
+      WHERE id = ?`,
+			clip.Text, clip.Metadata, clip.URL, false, clip.ID,
+		).Error
+		if err != nil {
+			slog.Error("failed to copy clip into memory", "id", clip.ID, "error", err)
+			return "", err
+		}
+	}
+
+	if err := tx.Exec(fmt.Sprintf(`
+    CREATE VIRTUAL TABLE temp.clip_index USING FTS5(
+			text,
+			url,
+			metadata,
+			content='clips',
+			content_rowid='id',
+			tokenize='%s'
+    );
+    `, tokenizer)).Error; err != nil {
+		slog.Error("failed to create in-memory FTS5 table", "error", err)
+		return "", err
+	}
+
+	err = tx.Exec(`INSERT INTO temp.clip_index(clip_index) VALUES('rebuild')`).
+		Error
+	if err != nil {
+		slog.Error("failed to build in-memory FTS index", "error", err)
+		return "", err
+	}
+
+	slog.Debug("in-memory FTS index built", "clips", len(clips))
+	return tokenizer, nil
+}
+
+// dropMemoryIndex drops the temp tables created by memoryIndex.
+func dropMemoryIndex(tx *gorm.DB) {
+	tx.Exec(`DROP TABLE IF EXISTS temp.clip_index`)
+	tx.Exec(`DROP TABLE IF EXISTS temp.clips`)
+}
+
+// search finds clips matching the query. Full text terms are matched with
+// the FTS index of given tokenizer, or with LIKE if tokenizer is empty. The
+// matched part of each clip is set as its snippet.
+func search(
+	ctx context.Context,
+	db *gorm.DB,
+	q Query,
+	tokenizer string,
+	limit int,
+	selection clipboard.Selection,
+) ([]clipboard.Clip, error) {
+	where, args, err := q.Where(tokenizer)
+	if err != nil {
 		return nil, err
 	}
 
-	slog.Debug(
-		"fallback LIKE search succeeded",
-		"query", query,
-		"results", len(clips),
-	)
+	tx := db.WithContext(ctx).Where(selectionCond(selection))
+	if where != "" {
+		tx = tx.Where(where, args...)
+	}
+
+	match := q.Match(tokenizer)
+	if match != "" {
+		tx = tx.Select(
+			"clips.*, snippet(clip_index, -1, ?, ?, ?, ?) AS snippet",
+			SnippetStart, SnippetEnd, snippetEllipsis, snippetTokens,
+		).
+			Joins("JOIN clip_index ON clip_index.rowid = clips.id").
+			Where("clip_index MATCH ?", match)
+	}
+
+	var clips []clipboard.Clip
+	err = tx.Order(binds.Clip.LastUsed.Desc()).
+		Limit(limit).
+		Find(&clips).Error
+	if err != nil || match != "" {
+		return clips, err
+	}
+
+	for i := range clips {
+		clips[i].Snippet = likeSnippet(clips[i], q.Terms)
+	}
 	return clips, nil
 }
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+)
+
+// Markers around the matches in clipboard.Clip.Snippet
+const (
+	SnippetStart = "\x02"
+	SnippetEnd   = "\x03"
+)
+
+const (
+	// snippetEllipsis marks text cut from a snippet
+	snippetEllipsis = "…"
+	// snippetTokens is the max number of tokens in a snippet from FTS index
+	snippetTokens = 24
+	// snippetContext is the number of characters around the match in a
+	// snippet found without FTS index
+	snippetContext = 40
+)
+
+// likeSnippet returns the text, url or metadata of the clip around the first
+// match of the terms with every match marked, like snippet() of FTS5.
+func likeSnippet(clip clipboard.Clip, terms []Term) string {
+	var needles []string
+	for t := range slices.Values(terms) {
+		if !t.Negate {
+			needles = append(needles, strings.ToLower(t.Text))
+		}
+	}
+	if len(needles) == 0 {
+		return ""
+	}
+
+	for text := range slices.Values([]string{clip.Text, clip.URL, clip.Metadata}) {
+		// matches are found in lower case, which must keep the byte offsets
+		lower := strings.ToLower(text)
+		if len(lower) != len(text) {
+			lower = text
+		}
+
+		first := -1
+		for n := range slices.Values(needles) {
+			i := strings.Index(lower, n)
+			if i != -1 && (first == -1 || i < first) {
+				first = i
+			}
+		}
+		if first == -1 {
+			continue
+		}
+
+		start := backRunes(text, first, snippetContext)
+		end := min(len(text), first+snippetContext*2)
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+
+		var b strings.Builder
+		if start > 0 {
+			b.WriteString(snippetEllipsis)
+		}
+		b.WriteString(markMatches(text[start:end], lower[start:end], needles))
+		if end < len(text) {
+			b.WriteString(snippetEllipsis)
+		}
+		return b.String()
+	}
+
+	return ""
+}
+
+// backRunes returns the byte offset n runes before i in s.
+func backRunes(s string, i, n int) int {
+	for ; i > 0 && n > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+// markMatches wraps every match of the needles found in lower with snippet
+// markers.
+func markMatches(text, lower string, needles []string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		n := 0
+		for needle := range slices.Values(needles) {
+			if needle != "" && strings.HasPrefix(lower[i:], needle) {
+				n = max(n, len(needle))
+			}
+		}
+		if n == 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			b.WriteString(text[i : i+size])
+			i += size
+			continue
+		}
+		b.WriteString(SnippetStart + text[i:i+n] + SnippetEnd)
+		i += n
+	}
+	return b.String()
+}
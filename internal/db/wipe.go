@@ -25,6 +25,11 @@ func Wipe(ctx context.Context) (int, error) {
 		return n, err
 	}
 
+	_, err = gorm.G[clipboard.Representation](db).Where("true").Delete(ctx)
+	if err != nil {
+		return n, err
+	}
+
 	if err := rebuildIndex(db); err != nil {
 		return n, err
 	}
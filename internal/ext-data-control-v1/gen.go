@@ -0,0 +1,3 @@
+package ext
+
+//go:generate go run github.com/neurlang/wayland/cmd/wayland-scanner@latest -i ./ext-data-control-v1.xml
@@ -0,0 +1,88 @@
+// Package ignore implements the rules of clips which are never recorded. The
+// rules are applied by the watcher before inserting a clip into history.
+package ignore
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+)
+
+// Text ignores clips with text matching the regular expression
+type Text struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// ParseText parses a text rule in the form of NAME=REGEX, e.g.
+// otp=^[0-9]{6}$.
+func ParseText(s string) (Text, error) {
+	name, expr, ok := strings.Cut(s, "=")
+	if !ok || name == "" || expr == "" {
+		return Text{}, fmt.Errorf("invalid text rule %q: expected NAME=REGEX", s)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return Text{}, fmt.Errorf("invalid regex of text rule %q: %w", name, err)
+	}
+	return Text{Name: name, Regexp: re}, nil
+}
+
+// ValidateMime checks that the mime rule is a valid pattern.
+func ValidateMime(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid mime pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// Rules are the rules of clips which are never recorded
+type Rules struct {
+	Texts []Text
+	// Mimes are path.Match patterns of the mime type of the clip, without
+	// parameters, e.g. image/*
+	Mimes []string
+	// MinLength ignores text clips with fewer characters, 0 is unlimited
+	MinLength int
+	// MaxLength ignores text clips with more characters, 0 is unlimited
+	MaxLength int
+}
+
+// Match returns the name of the first rule matching the clip. Returns false if
+// the clip is recorded.
+func (r Rules) Match(clip clipboard.Clip) (string, bool) {
+	mimeType, _, _ := strings.Cut(clip.Mime, ";")
+	mimeType = strings.TrimSpace(mimeType)
+	for _, pattern := range r.Mimes {
+		if ok, _ := path.Match(pattern, mimeType); ok {
+			return "ignore-mime=" + pattern, true
+		}
+	}
+
+	// blobs don't have text to match
+	if clip.BlobPath != "" || len(clip.Blob) != 0 {
+		return "", false
+	}
+
+	if r.MinLength > 0 || r.MaxLength > 0 {
+		n := utf8.RuneCountInString(clip.Text)
+		if r.MinLength > 0 && n < r.MinLength {
+			return "min-length", true
+		}
+		if r.MaxLength > 0 && n > r.MaxLength {
+			return "max-length", true
+		}
+	}
+
+	for _, rule := range r.Texts {
+		if rule.Regexp.MatchString(clip.Text) {
+			return rule.Name, true
+		}
+	}
+	return "", false
+}
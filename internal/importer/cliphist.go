@@ -0,0 +1,72 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/adrg/xdg"
+	bolt "go.etcd.io/bbolt"
+)
+
+// cliphistBucket is the bucket of the cliphist database with the items keyed
+// by their id, so the items are sorted oldest first.
+const cliphistBucket = "b"
+
+// CliphistDatabase returns the default path of the cliphist database.
+func CliphistDatabase() string {
+	return filepath.Join(xdg.CacheHome, "cliphist", "db")
+}
+
+// Cliphist reads the history of cliphist from its database. The database is
+// locked for reading until the import finishes, cliphist can't store new items
+// meanwhile.
+func Cliphist(path string) iter.Seq2[clipboard.Clip, error] {
+	return func(yield func(clipboard.Clip, error) bool) {
+		opts := &bolt.Options{ReadOnly: true, Timeout: time.Second}
+		db, err := bolt.Open(path, 0o600, opts)
+		if err != nil {
+			slog.Error(
+				"failed to open cliphist database",
+				"path", path,
+				"error", err,
+			)
+			yield(clipboard.Clip{}, err)
+			return
+		}
+		defer db.Close()
+
+		err = db.View(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(cliphistBucket))
+			// the bucket is created with the first item
+			if b == nil {
+				return nil
+			}
+
+			n := b.Stats().KeyN
+			start := time.Now()
+			c := b.Cursor()
+			i := 0
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if len(v) == 0 {
+					continue
+				}
+				// values are only valid during the transaction
+				t := itemTime(start, i, n)
+				if !yield(newClip(bytes.Clone(v), t), nil) {
+					return nil
+				}
+				i++
+			}
+			return nil
+		})
+		if err != nil {
+			err = fmt.Errorf("invalid cliphist database: %w", err)
+			yield(clipboard.Clip{}, err)
+		}
+	}
+}
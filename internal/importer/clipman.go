@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"iter"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+	"github.com/adrg/xdg"
+)
+
+// ClipmanHistory returns the default path of the clipman history file.
+func ClipmanHistory() string {
+	return filepath.Join(xdg.DataHome, "clipman.json")
+}
+
+// Clipman reads the clipman history file, a JSON array of text items, oldest
+// first. Clipman keeps text only.
+func Clipman(path string) iter.Seq2[clipboard.Clip, error] {
+	return func(yield func(clipboard.Clip, error) bool) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error(
+				"failed to read clipman history",
+				"path", path,
+				"error", err,
+			)
+			yield(clipboard.Clip{}, err)
+			return
+		}
+
+		var items []string
+		if err := json.Unmarshal(b, &items); err != nil {
+			err = fmt.Errorf("invalid clipman history: %w", err)
+			yield(clipboard.Clip{}, err)
+			return
+		}
+
+		start := time.Now()
+		for i, item := range items {
+			if item == "" {
+				continue
+			}
+			t := itemTime(start, i, len(items))
+			if !yield(newClip([]byte(item), t), nil) {
+				return
+			}
+		}
+	}
+}
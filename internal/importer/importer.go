@@ -0,0 +1,44 @@
+// Package importer reads the history of other clipboard managers as clips,
+// oldest first. Neither cliphist nor clipman records when an item is copied,
+// so the items are timed a millisecond apart before the import to keep their
+// order.
+package importer
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Nadim147c/yankd/pkg/clipboard"
+)
+
+// textMime is the MIME type of imported text, as offered by most
+// applications
+const textMime = "text/plain;charset=utf-8"
+
+// newClip creates a clip of the data with MIME type detected from its
+// content. Valid UTF-8 text, including markup, is kept as plain text and
+// anything else as blob.
+func newClip(data []byte, t time.Time) clipboard.Clip {
+	clip := clipboard.Clip{
+		Time:      t,
+		Selection: clipboard.SelectionClipboard,
+	}
+
+	mime := http.DetectContentType(data)
+	if strings.HasPrefix(mime, "text/") && utf8.Valid(data) {
+		clip.Mime = textMime
+		clip.Text = string(data)
+		return clip
+	}
+
+	clip.Mime, _, _ = strings.Cut(mime, ";")
+	clip.Blob = data
+	return clip
+}
+
+// itemTime returns the time of i-th item of n items, oldest first.
+func itemTime(start time.Time, i, n int) time.Time {
+	return start.Add(-time.Duration(n-i) * time.Millisecond)
+}
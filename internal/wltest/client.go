@@ -0,0 +1,469 @@
+package wltest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// serverIDStart is the first object id allocated by the server
+const serverIDStart = 0xff000000
+
+// Request opcodes
+const (
+	displaySync        = 0
+	displayGetRegistry = 1
+
+	registryBind = 0
+
+	seatRelease = 3
+
+	managerCreateSource = 0
+	managerGetDevice    = 1
+	managerDestroy      = 2
+
+	deviceSetSelection        = 0
+	deviceDestroy             = 1
+	deviceSetPrimarySelection = 2
+
+	sourceOffer   = 0
+	sourceDestroy = 1
+
+	offerReceive = 0
+	offerDestroy = 1
+)
+
+// Event opcodes
+const (
+	displayError    = 0
+	displayDeleteID = 1
+
+	callbackDone = 0
+
+	registryGlobal       = 0
+	registryGlobalRemove = 1
+
+	seatCapabilities = 0
+	seatName         = 1
+
+	deviceDataOffer        = 0
+	deviceSelection        = 1
+	deviceFinished         = 2
+	devicePrimarySelection = 3
+
+	sourceSend      = 0
+	sourceCancelled = 1
+
+	offerOffer = 0
+)
+
+// client is a connection to the compositor. The objects are guarded by the
+// compositor lock.
+type client struct {
+	comp    *Compositor
+	conn    *net.UnixConn
+	wmu     sync.Mutex // serializes writes
+	objects map[uint32]object
+	nextID  uint32
+	fds     []int // received and not yet consumed
+	serial  uint32
+}
+
+// object handles requests sent to a wayland object
+type object interface {
+	request(c *client, id uint32, opcode uint16, m *message) error
+}
+
+// serve handles requests until the connection is closed.
+func (c *client) serve() {
+	defer c.cleanup()
+	for {
+		id, opcode, m, err := c.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("fake compositor read failed", "error", err)
+			}
+			return
+		}
+
+		c.comp.mu.Lock()
+		obj, ok := c.objects[id]
+		if ok {
+			err = obj.request(c, id, opcode, m)
+		} else {
+			err = fmt.Errorf("unknown object %d", id)
+		}
+		c.comp.mu.Unlock()
+
+		if err != nil {
+			slog.Warn("fake compositor protocol error", "object", id, "error", err)
+			c.send(1, displayError, id, uint32(0), err.Error())
+			return
+		}
+	}
+}
+
+// cleanup destroys every object of the client and closes the connection.
+func (c *client) cleanup() {
+	c.comp.mu.Lock()
+	defer c.comp.mu.Unlock()
+
+	delete(c.comp.clients, c)
+	for _, obj := range c.objects {
+		switch obj := obj.(type) {
+		case *Source:
+			c.comp.destroySource(obj)
+		case *device:
+			delete(obj.seat.devices, obj)
+		}
+	}
+	for _, f := range c.fds {
+		syscall.Close(f)
+	}
+	c.conn.Close()
+}
+
+// newID allocates a server side object id.
+func (c *client) newID() uint32 {
+	id := c.nextID
+	c.nextID++
+	return id
+}
+
+// remove removes a destroyed object.
+func (c *client) remove(id uint32) {
+	delete(c.objects, id)
+	c.send(1, displayDeleteID, id)
+}
+
+// announce sends a new global to every registry of the client.
+func (c *client) announce(name uint32, iface string) {
+	for id, obj := range c.objects {
+		if _, ok := obj.(registryObject); ok {
+			c.send(id, registryGlobal, name, iface, c.comp.versions[iface])
+		}
+	}
+}
+
+// withdraw sends removal of a global to every registry of the client.
+func (c *client) withdraw(name uint32) {
+	for id, obj := range c.objects {
+		if _, ok := obj.(registryObject); ok {
+			c.send(id, registryGlobalRemove, name)
+		}
+	}
+}
+
+type displayObject struct{}
+
+func (displayObject) request(c *client, _ uint32, opcode uint16, m *message) error {
+	newID, err := m.uint32()
+	if err != nil {
+		return err
+	}
+
+	switch opcode {
+	case displaySync:
+		c.serial++
+		c.send(newID, callbackDone, c.serial)
+		c.send(1, displayDeleteID, newID)
+	case displayGetRegistry:
+		c.objects[newID] = registryObject{}
+		for name, iface := range c.comp.globals {
+			c.send(newID, registryGlobal, name, iface, c.comp.versions[iface])
+		}
+	default:
+		return fmt.Errorf("invalid wl_display opcode %d", opcode)
+	}
+	return nil
+}
+
+type registryObject struct{}
+
+func (registryObject) request(c *client, _ uint32, opcode uint16, m *message) error {
+	if opcode != registryBind {
+		return fmt.Errorf("invalid wl_registry opcode %d", opcode)
+	}
+
+	name, err := m.uint32()
+	if err != nil {
+		return err
+	}
+	iface, err := m.string()
+	if err != nil {
+		return err
+	}
+	version, err := m.uint32()
+	if err != nil {
+		return err
+	}
+	newID, err := m.uint32()
+	if err != nil {
+		return err
+	}
+
+	if c.comp.globals[name] != iface {
+		return fmt.Errorf("no %s global named %d", iface, name)
+	}
+	if version == 0 || version > c.comp.versions[iface] {
+		return fmt.Errorf("invalid %s version %d", iface, version)
+	}
+
+	if iface != "wl_seat" {
+		c.objects[newID] = managerObject{iface: iface, version: version}
+		return nil
+	}
+
+	var seat *seatState
+	for _, s := range c.comp.seats {
+		if s.global == name {
+			seat = s
+		}
+	}
+	c.objects[newID] = seatObject{seat: seat}
+	c.send(newID, seatCapabilities, uint32(0))
+	if version >= 2 {
+		c.send(newID, seatName, seat.name)
+	}
+	return nil
+}
+
+type seatObject struct {
+	seat *seatState
+}
+
+func (seatObject) request(c *client, id uint32, opcode uint16, _ *message) error {
+	if opcode != seatRelease {
+		return fmt.Errorf("unsupported wl_seat opcode %d", opcode)
+	}
+	c.remove(id)
+	return nil
+}
+
+type managerObject struct {
+	iface   string
+	version uint32
+}
+
+func (mgr managerObject) request(c *client, id uint32, opcode uint16, m *message) error {
+	switch opcode {
+	case managerCreateSource:
+		newID, err := m.uint32()
+		if err != nil {
+			return err
+		}
+		c.objects[newID] = &Source{client: c, id: newID}
+	case managerGetDevice:
+		newID, err := m.uint32()
+		if err != nil {
+			return err
+		}
+		seatID, err := m.uint32()
+		if err != nil {
+			return err
+		}
+		seat, ok := c.objects[seatID].(seatObject)
+		if !ok {
+			return fmt.Errorf("object %d is not a wl_seat", seatID)
+		}
+
+		d := &device{
+			client:  c,
+			id:      newID,
+			seat:    seat.seat,
+			primary: mgr.iface == ExtDataControl || mgr.version >= 2,
+		}
+		c.objects[newID] = d
+
+		if c.comp.seats[seat.seat.name] != seat.seat {
+			c.send(newID, deviceFinished)
+			return nil
+		}
+		seat.seat.devices[d] = struct{}{}
+		for sel, current := range seat.seat.selections {
+			d.sendSelection(Selection(sel), current)
+		}
+	case managerDestroy:
+		c.remove(id)
+	default:
+		return fmt.Errorf("invalid %s opcode %d", mgr.iface, opcode)
+	}
+	return nil
+}
+
+// device is a data control device
+type device struct {
+	client  *client
+	id      uint32
+	seat    *seatState
+	primary bool // supports primary selection
+}
+
+func (d *device) request(c *client, id uint32, opcode uint16, m *message) error {
+	switch opcode {
+	case deviceSetSelection, deviceSetPrimarySelection:
+		sel := Clipboard
+		if opcode == deviceSetPrimarySelection {
+			if !d.primary {
+				return errors.New("set_primary_selection needs version 2")
+			}
+			sel = Primary
+		}
+
+		srcID, err := m.uint32()
+		if err != nil {
+			return err
+		}
+		if srcID == 0 {
+			c.comp.setSelection(d.seat, sel, nil)
+			return nil
+		}
+
+		src, ok := c.objects[srcID].(*Source)
+		if !ok {
+			return fmt.Errorf("object %d is not a data source", srcID)
+		}
+		if _, ok := d.seat.devices[d]; !ok {
+			return nil // seat is removed
+		}
+		c.comp.setSelection(d.seat, sel, &selection{
+			mimes:  slices.Clone(src.mimes),
+			source: src,
+		})
+	case deviceDestroy:
+		delete(d.seat.devices, d)
+		c.remove(id)
+	default:
+		return fmt.Errorf("invalid data device opcode %d", opcode)
+	}
+	return nil
+}
+
+// sendSelection offers the selection to the device. Nil selection clears it.
+func (d *device) sendSelection(sel Selection, current *selection) {
+	if sel == Primary && !d.primary {
+		return
+	}
+	opcode := uint16(deviceSelection)
+	if sel == Primary {
+		opcode = devicePrimarySelection
+	}
+
+	if current == nil {
+		d.client.send(d.id, opcode, uint32(0))
+		return
+	}
+
+	offerID := d.client.newID()
+	d.client.objects[offerID] = &offerObject{sel: current}
+	d.client.send(d.id, deviceDataOffer, offerID)
+	for _, mime := range current.mimes {
+		d.client.send(offerID, offerOffer, mime)
+	}
+	d.client.send(d.id, opcode, offerID)
+}
+
+func (s *Source) request(c *client, id uint32, opcode uint16, m *message) error {
+	switch opcode {
+	case sourceOffer:
+		mime, err := m.string()
+		if err != nil {
+			return err
+		}
+		s.mimes = append(s.mimes, mime)
+	case sourceDestroy:
+		c.comp.destroySource(s)
+		c.remove(id)
+	default:
+		return fmt.Errorf("invalid data source opcode %d", opcode)
+	}
+	return nil
+}
+
+// destroySource clears every selection served by the source. Must be called
+// with c.mu held.
+func (c *Compositor) destroySource(src *Source) {
+	src.destroyed = true
+	for _, s := range c.seats {
+		for sel, current := range s.selections {
+			if current != nil && current.source == src {
+				c.setSelection(s, Selection(sel), nil)
+			}
+		}
+	}
+}
+
+// offerObject is a data offer of a selection
+type offerObject struct {
+	sel *selection
+}
+
+func (o *offerObject) request(c *client, id uint32, opcode uint16, m *message) error {
+	switch opcode {
+	case offerReceive:
+		mime, err := m.string()
+		if err != nil {
+			return err
+		}
+		raw, err := m.fd()
+		if err != nil {
+			return err
+		}
+		o.receive(mime, os.NewFile(uintptr(raw), mime))
+	case offerDestroy:
+		c.remove(id)
+	default:
+		return fmt.Errorf("invalid data offer opcode %d", opcode)
+	}
+	return nil
+}
+
+// receive writes the data of the MIME type to file. Data of a client source
+// is written by the client.
+func (o *offerObject) receive(mime string, file *os.File) {
+	if src := o.sel.source; src != nil {
+		defer file.Close()
+		if !src.destroyed {
+			src.client.send(src.id, sourceSend, mime, fd(file.Fd()))
+		}
+		return
+	}
+
+	p, ok := o.sel.payloads[mime]
+	if !ok {
+		file.Close()
+		return
+	}
+	go func() {
+		defer file.Close()
+		time.Sleep(p.Delay)
+		file.Write(p.Data)
+	}()
+}
+
+// receive reads the data written into the pipe passed to send.
+func receive(send func(fd) error) ([]byte, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	err = send(fd(w.Fd()))
+	w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.SetReadDeadline(time.Now().Add(receiveTimeout)); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -0,0 +1,363 @@
+// Package wltest implements a fake wayland compositor for end-to-end tests of
+// the clipboard client. It serves wl_seat and the server side of
+// ext-data-control-v1 and wlr-data-control-unstable-v1, so the watcher and
+// set can run without a real compositor, e.g. on a headless CI box.
+//
+// The wayland client only dials a socket path, so the compositor listens in a
+// private runtime directory:
+//
+//	comp, err := wltest.New(t.TempDir())
+//	...
+//	defer comp.Close()
+//	t.Setenv("XDG_RUNTIME_DIR", comp.RuntimeDir())
+//	t.Setenv("WAYLAND_DISPLAY", comp.Display())
+//	comp.AddSeat("seat0")
+//	comp.Offer("seat0", wltest.Clipboard, wltest.Payload{
+//		Mime: "text/plain",
+//		Data: []byte("hello"),
+//	})
+package wltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Interface names of the data control managers
+const (
+	ExtDataControl = "ext_data_control_manager_v1"
+	WlrDataControl = "zwlr_data_control_manager_v1"
+)
+
+// versions are the advertised versions of the globals
+var versions = map[string]uint32{
+	"wl_seat":      5,
+	ExtDataControl: 1,
+	WlrDataControl: 2,
+}
+
+// Selection is a selection of a seat
+type Selection int
+
+// Selections of a seat
+const (
+	Clipboard Selection = iota
+	Primary
+)
+
+// String returns the name of the selection.
+func (s Selection) String() string {
+	if s == Primary {
+		return "primary"
+	}
+	return "clipboard"
+}
+
+// receiveTimeout limits reading data of a source set by a client
+const receiveTimeout = 5 * time.Second
+
+// Payload is the data of an offered MIME type
+type Payload struct {
+	Mime string
+	Data []byte
+	// Delay is waited before the data is written, e.g. to simulate a source
+	// which never answers.
+	Delay time.Duration
+}
+
+// Compositor is a fake wayland compositor
+type Compositor struct {
+	dir     string
+	display string
+	ln      *net.UnixListener
+	wg      sync.WaitGroup
+
+	mu       sync.Mutex
+	globals  map[uint32]string // name -> interface
+	seats    map[string]*seatState
+	clients  map[*client]struct{}
+	nextName uint32
+	changed  chan struct{} // closed when a selection changes
+	versions map[string]uint32
+}
+
+// seatState is a seat with its selections
+type seatState struct {
+	name       string
+	global     uint32
+	selections [2]*selection
+	devices    map[*device]struct{}
+}
+
+// selection is offered either by the compositor or by a client source
+type selection struct {
+	mimes    []string
+	payloads map[string]Payload
+	source   *Source
+}
+
+// New starts a compositor listening in dir advertising the given data control
+// managers. Both managers are advertised if none is given.
+func New(dir string, managers ...string) (*Compositor, error) {
+	if len(managers) == 0 {
+		managers = []string{ExtDataControl, WlrDataControl}
+	}
+
+	c := &Compositor{
+		dir:      dir,
+		display:  "wayland-test",
+		globals:  make(map[uint32]string),
+		seats:    make(map[string]*seatState),
+		clients:  make(map[*client]struct{}),
+		nextName: 1,
+		changed:  make(chan struct{}),
+		versions: maps.Clone(versions),
+	}
+	for _, iface := range managers {
+		if _, ok := versions[iface]; !ok {
+			return nil, fmt.Errorf("unknown data control manager %q", iface)
+		}
+		c.globals[c.nextName] = iface
+		c.nextName++
+	}
+
+	addr := &net.UnixAddr{Name: filepath.Join(dir, c.display), Net: "unix"}
+	ln, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	c.ln = ln
+
+	c.wg.Go(c.accept)
+	slog.Debug("fake compositor listening", "path", addr.Name)
+	return c, nil
+}
+
+// RuntimeDir returns the directory to use as XDG_RUNTIME_DIR.
+func (c *Compositor) RuntimeDir() string { return c.dir }
+
+// Display returns the name to use as WAYLAND_DISPLAY.
+func (c *Compositor) Display() string { return c.display }
+
+// Close disconnects every client and stops listening.
+func (c *Compositor) Close() error {
+	err := c.ln.Close()
+	c.Disconnect()
+	c.wg.Wait()
+	return err
+}
+
+// Disconnect closes the connection of every client, e.g. to simulate a
+// compositor restart. New clients can still connect.
+func (c *Compositor) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for cl := range c.clients {
+		cl.conn.Close()
+	}
+}
+
+func (c *Compositor) accept() {
+	for {
+		conn, err := c.ln.AcceptUnix()
+		if err != nil {
+			return
+		}
+		cl := &client{
+			comp:    c,
+			conn:    conn,
+			objects: make(map[uint32]object),
+			nextID:  serverIDStart,
+		}
+		cl.objects[1] = displayObject{}
+
+		c.mu.Lock()
+		c.clients[cl] = struct{}{}
+		c.mu.Unlock()
+
+		c.wg.Go(cl.serve)
+	}
+}
+
+// SetVersion sets the advertised version of the global interface, e.g. 1 for
+// a wlr data control manager without the primary selection. Clients connected
+// before keep the previous version.
+func (c *Compositor) SetVersion(iface string, version uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.versions[iface] = version
+}
+
+// AddSeat advertises a new wl_seat global with given name.
+func (c *Compositor) AddSeat(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := &seatState{
+		name:    name,
+		global:  c.nextName,
+		devices: make(map[*device]struct{}),
+	}
+	c.nextName++
+	c.seats[name] = s
+	c.globals[s.global] = "wl_seat"
+
+	for cl := range c.clients {
+		cl.announce(s.global, "wl_seat")
+	}
+}
+
+// RemoveSeat removes the wl_seat global with given name. Data devices of the
+// seat are finished.
+func (c *Compositor) RemoveSeat(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.seats[name]
+	if !ok {
+		return
+	}
+	delete(c.seats, name)
+	delete(c.globals, s.global)
+
+	for cl := range c.clients {
+		cl.withdraw(s.global)
+	}
+	for d := range s.devices {
+		d.client.send(d.id, deviceFinished)
+	}
+	s.devices = nil
+}
+
+// Offer sets the selection of the seat to the payloads, as if an application
+// copied them. Payloads are offered in the given order.
+func (c *Compositor) Offer(seat string, sel Selection, payloads ...Payload) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.seats[seat]
+	if !ok {
+		return fmt.Errorf("no seat named %q", seat)
+	}
+
+	offer := &selection{payloads: make(map[string]Payload)}
+	for _, p := range payloads {
+		offer.mimes = append(offer.mimes, p.Mime)
+		offer.payloads[p.Mime] = p
+	}
+	c.setSelection(s, sel, offer)
+	return nil
+}
+
+// Clear clears the selection of the seat, as if the source application exited.
+func (c *Compositor) Clear(seat string, sel Selection) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.seats[seat]
+	if !ok {
+		return fmt.Errorf("no seat named %q", seat)
+	}
+	c.setSelection(s, sel, nil)
+	return nil
+}
+
+// Source returns the source a client set as the selection of the seat, or nil.
+func (c *Compositor) Source(seat string, sel Selection) *Source {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.source(seat, sel)
+}
+
+func (c *Compositor) source(seat string, sel Selection) *Source {
+	s, ok := c.seats[seat]
+	if !ok || s.selections[sel] == nil {
+		return nil
+	}
+	return s.selections[sel].source
+}
+
+// WaitSource waits until a client sets a source as the selection of the seat.
+func (c *Compositor) WaitSource(
+	ctx context.Context,
+	seat string,
+	sel Selection,
+) (*Source, error) {
+	for {
+		c.mu.Lock()
+		src, changed := c.source(seat, sel), c.changed
+		c.mu.Unlock()
+		if src != nil {
+			return src, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// setSelection replaces the selection of the seat and announces it to every
+// data device of the seat. Must be called with c.mu held.
+func (c *Compositor) setSelection(s *seatState, sel Selection, next *selection) {
+	if prev := s.selections[sel]; prev != nil && prev.source != nil {
+		prev.source.cancel()
+	}
+	s.selections[sel] = next
+
+	for d := range s.devices {
+		d.sendSelection(sel, next)
+	}
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+	slog.Debug("fake compositor selection changed", "seat", s.name, "selection", sel)
+}
+
+// Source is a data source created by a client
+type Source struct {
+	client    *client
+	id        uint32
+	mimes     []string
+	destroyed bool
+}
+
+// Mimes returns the MIME types offered by the source.
+func (s *Source) Mimes() []string {
+	s.client.comp.mu.Lock()
+	defer s.client.comp.mu.Unlock()
+	return slices.Clone(s.mimes)
+}
+
+// Receive reads the data of the MIME type from the client.
+func (s *Source) Receive(mime string) ([]byte, error) {
+	s.client.comp.mu.Lock()
+	if s.destroyed {
+		s.client.comp.mu.Unlock()
+		return nil, errors.New("source is destroyed")
+	}
+	s.client.comp.mu.Unlock()
+
+	return receive(func(f fd) error {
+		return s.client.send(s.id, sourceSend, mime, f)
+	})
+}
+
+// cancel tells the client the source is replaced. Must be called with the
+// compositor lock held.
+func (s *Source) cancel() {
+	if s.destroyed {
+		return
+	}
+	s.client.send(s.id, sourceCancelled)
+}
@@ -0,0 +1,125 @@
+package wltest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// maxFds is the max number of file descriptors received with a request
+const maxFds = 4
+
+// fd is a file descriptor argument of an event
+type fd int
+
+// message is the payload of a request
+type message struct {
+	data []byte
+	c    *client
+}
+
+var errShortMessage = errors.New("message is too short")
+
+func (m *message) uint32() (uint32, error) {
+	if len(m.data) < 4 {
+		return 0, errShortMessage
+	}
+	v := binary.NativeEndian.Uint32(m.data)
+	m.data = m.data[4:]
+	return v, nil
+}
+
+func (m *message) string() (string, error) {
+	n, err := m.uint32()
+	if err != nil {
+		return "", err
+	}
+	padded := (int(n) + 3) &^ 3
+	if n == 0 || len(m.data) < padded {
+		return "", errShortMessage
+	}
+	s := string(m.data[:n-1]) // without the terminating NUL
+	m.data = m.data[padded:]
+	return s, nil
+}
+
+func (m *message) fd() (int, error) {
+	if len(m.c.fds) == 0 {
+		return -1, errors.New("no file descriptor received")
+	}
+	f := m.c.fds[0]
+	m.c.fds = m.c.fds[1:]
+	return f, nil
+}
+
+// readMessage reads a request and the file descriptors sent with it.
+func (c *client) readMessage() (uint32, uint16, *message, error) {
+	header := make([]byte, 8)
+	oob := make([]byte, syscall.CmsgSpace(maxFds*4))
+	n, oobn, _, _, err := c.conn.ReadMsgUnix(header, oob)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if _, err := io.ReadFull(c.conn, header[n:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	if oobn > 0 {
+		scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("failed to parse control message: %w", err)
+		}
+		for _, scm := range scms {
+			fds, err := syscall.ParseUnixRights(&scm)
+			if err != nil {
+				return 0, 0, nil, fmt.Errorf("failed to parse unix rights: %w", err)
+			}
+			c.fds = append(c.fds, fds...)
+		}
+	}
+
+	id := binary.NativeEndian.Uint32(header[0:4])
+	word := binary.NativeEndian.Uint32(header[4:8])
+	size, opcode := word>>16, uint16(word)
+	if size < 8 {
+		return 0, 0, nil, fmt.Errorf("invalid message size %d", size)
+	}
+
+	data := make([]byte, size-8)
+	if _, err := io.ReadFull(c.conn, data); err != nil {
+		return 0, 0, nil, err
+	}
+	return id, opcode, &message{data: data, c: c}, nil
+}
+
+// send sends an event. Arguments can be uint32, string or fd.
+func (c *client) send(id uint32, opcode uint16, args ...any) error {
+	var data, oob []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			data = binary.NativeEndian.AppendUint32(data, v)
+		case string:
+			n := len(v) + 1
+			data = binary.NativeEndian.AppendUint32(data, uint32(n))
+			data = append(data, v...)
+			data = append(data, make([]byte, (n+3)&^3-len(v))...)
+		case fd:
+			oob = append(oob, syscall.UnixRights(int(v))...)
+		default:
+			return fmt.Errorf("invalid argument type %T", arg)
+		}
+	}
+
+	buf := binary.NativeEndian.AppendUint32(nil, id)
+	size := uint32(len(data) + 8)
+	buf = binary.NativeEndian.AppendUint32(buf, size<<16|uint32(opcode))
+	buf = append(buf, data...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, _, err := c.conn.WriteMsgUnix(buf, oob, nil)
+	return err
+}
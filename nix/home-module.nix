@@ -12,6 +12,7 @@ let
     mkEnableOption
     mkIf
     mkOption
+    optionalString
     ;
   inherit (lib.types)
     attrs
@@ -23,6 +24,16 @@ let
   pkg = self.packages.${pkgs.stdenv.hostPlatform.system}.default;
   cfg = config.services.yankd;
   format = pkgs.formats.json { };
+
+  # the settings are checked against the schema at build time, unless no
+  # package is installed to check them with
+  configFile = pkgs.runCommand "yankd-config.json" { } ''
+    export HOME="$TMPDIR"
+    cp ${format.generate "yankd.json" cfg.settings} "$out"
+    ${optionalString (cfg.package != null) ''
+      ${getExe cfg.package} config check "$out"
+    ''}
+  '';
 in
 {
   options.services.yankd = {
@@ -53,7 +64,7 @@ in
     home.packages = mkIf (cfg.package != null) [ cfg.package ];
 
     xdg.configFile = mkIf (cfg.settings != { }) {
-      "yankd/config.json".source = format.generate "yankd.json" cfg.settings;
+      "yankd/config.json".source = configFile;
     };
 
     systemd.user.services.yankd = {
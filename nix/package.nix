@@ -3,11 +3,8 @@
   fetchFromGitHub,
   installShellFiles,
   lib,
-  makeBinaryWrapper,
   stdenv,
   versionCheckHook,
-  # TODO: remove wl-clipboard dependencies
-  wl-clipboard,
 }:
 buildGoModule rec {
   pname = "yankd";
@@ -22,11 +19,7 @@ buildGoModule rec {
 
   vendorHash = "sha256-qmKm1Y4q43hWRdF1leT+2UujX9VlBJmpP51rxhpnBc4=";
 
-  nativeBuildInputs = [
-    installShellFiles
-    makeBinaryWrapper
-  ];
-  propagatedBuildInputs = [ wl-clipboard ];
+  nativeBuildInputs = [ installShellFiles ];
 
   nativeInstallCheckInputs = [ versionCheckHook ];
   versionCheckProgramArg = "--version";
@@ -36,9 +29,6 @@ buildGoModule rec {
       --bash <($out/bin/yankd _carapace bash) \
       --fish <($out/bin/yankd _carapace fish) \
       --zsh <($out/bin/yankd _carapace zsh)
-
-    wrapProgram $out/bin/yankd \
-      --prefix PATH : ${lib.makeBinPath [ wl-clipboard ]}
   '';
 
   ldflags = [
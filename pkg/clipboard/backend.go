@@ -0,0 +1,83 @@
+package clipboard
+
+import (
+	"errors"
+
+	"github.com/neurlang/wayland/wl"
+)
+
+const (
+	// ExtInterfaceName is the ext-data-control-v1 interface name
+	ExtInterfaceName = "ext_data_control_manager_v1"
+	// WlrInterfaceName is the wlr-data-control-unstable-v1 interface name
+	WlrInterfaceName = "zwlr_data_control_manager_v1"
+)
+
+// errNoPrimary is returned when setting the primary selection with a data
+// control manager not supporting it
+var errNoPrimary = errors.New(
+	"primary selection is not supported by the data control manager",
+)
+
+// backends are the supported data control protocols in order of preference.
+var backends = []struct {
+	iface string
+	bind  func(r *wl.Registry, name, version uint32) (backend, error)
+}{
+	{ExtInterfaceName, bindExt},
+	{WlrInterfaceName, bindWlr},
+}
+
+// backend is a bound data control manager of one of the supported protocols
+type backend interface {
+	// createSource creates a data source sending its events to h.
+	createSource(h sourceHandler) (dataSource, error)
+	// getDevice creates a data device for the seat sending its events to h.
+	// Events are not handled if h is nil.
+	getDevice(seat *wl.Seat, h deviceHandler) (dataDevice, error)
+	// primary reports whether the primary selection is supported.
+	primary() bool
+}
+
+// dataDevice is a data control device of a seat
+type dataDevice interface {
+	id() wl.ProxyId
+	setSelection(src dataSource) error
+	setPrimarySelection(src dataSource) error
+	destroy() error
+}
+
+// dataSource is a data control source offering data to other clients
+type dataSource interface {
+	offer(mimeType string) error
+	destroy() error
+}
+
+// dataOffer is a data control offer advertised by the compositor. Offers of
+// the same object must be comparable as equal.
+type dataOffer interface {
+	id() wl.ProxyId
+	receive(mimeType string, fd uintptr) error
+	destroy() error
+	addOfferHandler(h offerHandler)
+}
+
+// deviceHandler handles events of a data device. Offer is nil when the
+// selection is cleared.
+type deviceHandler interface {
+	handleDataOffer(offer dataOffer)
+	handleSelection(offer dataOffer)
+	handlePrimarySelection(offer dataOffer)
+	handleFinished()
+}
+
+// sourceHandler handles events of a data source
+type sourceHandler interface {
+	handleSend(mimeType string, fd uintptr, err error)
+	handleCancelled()
+}
+
+// offerHandler handles mime types advertised by a data offer
+type offerHandler interface {
+	handleOffer(mimeType string)
+}
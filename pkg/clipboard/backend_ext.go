@@ -0,0 +1,156 @@
+package clipboard
+
+import (
+	"errors"
+
+	ext "github.com/Nadim147c/yankd/internal/ext-data-control-v1"
+	"github.com/neurlang/wayland/wl"
+)
+
+// extVersion is the latest supported ext_data_control_manager_v1 version
+const extVersion = 1
+
+type extBackend struct {
+	manager *ext.DataControlManagerV1
+}
+
+func bindExt(r *wl.Registry, name, version uint32) (backend, error) {
+	manager := ext.NewDataControlManagerV1(r.Context())
+	err := r.Bind(name, ExtInterfaceName, min(version, extVersion), manager)
+	if err != nil {
+		return nil, err
+	}
+	return &extBackend{manager: manager}, nil
+}
+
+func (b *extBackend) primary() bool { return true }
+
+func (b *extBackend) createSource(h sourceHandler) (dataSource, error) {
+	proxy, err := b.manager.CreateDataSource()
+	if err != nil {
+		return nil, err
+	}
+	src := &extSource{proxy: proxy, h: h}
+	proxy.AddSendHandler(src)
+	proxy.AddCancelledHandler(src)
+	return src, nil
+}
+
+func (b *extBackend) getDevice(
+	seat *wl.Seat,
+	h deviceHandler,
+) (dataDevice, error) {
+	proxy, err := b.manager.GetDataDevice(seat)
+	if err != nil {
+		return nil, err
+	}
+	device := &extDevice{proxy: proxy, h: h}
+	if h != nil {
+		proxy.AddDataOfferHandler(device)
+		proxy.AddSelectionHandler(device)
+		proxy.AddPrimarySelectionHandler(device)
+		proxy.AddFinishedHandler(device)
+	}
+	return device, nil
+}
+
+type extDevice struct {
+	proxy *ext.DataControlDeviceV1
+	h     deviceHandler
+}
+
+func (d *extDevice) id() wl.ProxyId { return d.proxy.Id() }
+func (d *extDevice) destroy() error { return d.proxy.Destroy() }
+
+func (d *extDevice) setSelection(src dataSource) error {
+	s, ok := src.(*extSource)
+	if !ok {
+		return errors.New("data source is not an ext data source")
+	}
+	return d.proxy.SetSelection(s.proxy)
+}
+
+func (d *extDevice) setPrimarySelection(src dataSource) error {
+	s, ok := src.(*extSource)
+	if !ok {
+		return errors.New("data source is not an ext data source")
+	}
+	return d.proxy.SetPrimarySelection(s.proxy)
+}
+
+func (d *extDevice) HandleDataControlDeviceV1DataOffer(
+	e ext.DataControlDeviceV1DataOfferEvent,
+) {
+	d.h.handleDataOffer(extOffer{e.Id})
+}
+
+func (d *extDevice) HandleDataControlDeviceV1Selection(
+	e ext.DataControlDeviceV1SelectionEvent,
+) {
+	if e.Id == nil {
+		d.h.handleSelection(nil)
+		return
+	}
+	d.h.handleSelection(extOffer{e.Id})
+}
+
+func (d *extDevice) HandleDataControlDeviceV1PrimarySelection(
+	e ext.DataControlDeviceV1PrimarySelectionEvent,
+) {
+	if e.Id == nil {
+		d.h.handlePrimarySelection(nil)
+		return
+	}
+	d.h.handlePrimarySelection(extOffer{e.Id})
+}
+
+func (d *extDevice) HandleDataControlDeviceV1Finished(
+	ext.DataControlDeviceV1FinishedEvent,
+) {
+	d.h.handleFinished()
+}
+
+type extSource struct {
+	proxy *ext.DataControlSourceV1
+	h     sourceHandler
+}
+
+func (s *extSource) offer(mimeType string) error { return s.proxy.Offer(mimeType) }
+func (s *extSource) destroy() error              { return s.proxy.Destroy() }
+
+func (s *extSource) HandleDataControlSourceV1Send(
+	e ext.DataControlSourceV1SendEvent,
+) {
+	s.h.handleSend(e.MimeType, e.Fd, e.FdError)
+}
+
+func (s *extSource) HandleDataControlSourceV1Cancelled(
+	ext.DataControlSourceV1CancelledEvent,
+) {
+	s.h.handleCancelled()
+}
+
+type extOffer struct {
+	proxy *ext.DataControlOfferV1
+}
+
+func (o extOffer) id() wl.ProxyId { return o.proxy.Id() }
+func (o extOffer) destroy() error { return o.proxy.Destroy() }
+
+func (o extOffer) receive(mimeType string, fd uintptr) error {
+	return o.proxy.Receive(mimeType, fd)
+}
+
+func (o extOffer) addOfferHandler(h offerHandler) {
+	o.proxy.AddOfferHandler(extOfferHandler{h})
+}
+
+type extOfferHandler struct {
+	h offerHandler
+}
+
+func (o extOfferHandler) HandleDataControlOfferV1Offer(
+	e ext.DataControlOfferV1OfferEvent,
+) {
+	o.h.handleOffer(e.MimeType)
+}
@@ -0,0 +1,169 @@
+package clipboard
+
+import (
+	"errors"
+
+	wlr "github.com/Nadim147c/yankd/internal/wlr-data-control-unstable-v1"
+	"github.com/neurlang/wayland/wl"
+)
+
+const (
+	// wlrVersion is the latest supported zwlr_data_control_manager_v1 version
+	wlrVersion = 2
+	// wlrPrimaryVersion is the first version with the primary selection
+	wlrPrimaryVersion = 2
+)
+
+type wlrBackend struct {
+	manager *wlr.ZwlrDataControlManagerV1
+	version uint32
+}
+
+func bindWlr(r *wl.Registry, name, version uint32) (backend, error) {
+	manager := wlr.NewZwlrDataControlManagerV1(r.Context())
+	version = min(version, wlrVersion)
+	err := r.Bind(name, WlrInterfaceName, version, manager)
+	if err != nil {
+		return nil, err
+	}
+	return &wlrBackend{manager: manager, version: version}, nil
+}
+
+func (b *wlrBackend) primary() bool { return b.version >= wlrPrimaryVersion }
+
+func (b *wlrBackend) createSource(h sourceHandler) (dataSource, error) {
+	proxy, err := b.manager.CreateDataSource()
+	if err != nil {
+		return nil, err
+	}
+	src := &wlrSource{proxy: proxy, h: h}
+	proxy.AddSendHandler(src)
+	proxy.AddCancelledHandler(src)
+	return src, nil
+}
+
+func (b *wlrBackend) getDevice(
+	seat *wl.Seat,
+	h deviceHandler,
+) (dataDevice, error) {
+	proxy, err := b.manager.GetDataDevice(seat)
+	if err != nil {
+		return nil, err
+	}
+	device := &wlrDevice{proxy: proxy, h: h, primary: b.primary()}
+	if h != nil {
+		proxy.AddDataOfferHandler(device)
+		proxy.AddSelectionHandler(device)
+		if device.primary {
+			proxy.AddPrimarySelectionHandler(device)
+		}
+		proxy.AddFinishedHandler(device)
+	}
+	return device, nil
+}
+
+type wlrDevice struct {
+	proxy   *wlr.ZwlrDataControlDeviceV1
+	h       deviceHandler
+	primary bool
+}
+
+func (d *wlrDevice) id() wl.ProxyId { return d.proxy.Id() }
+func (d *wlrDevice) destroy() error { return d.proxy.Destroy() }
+
+func (d *wlrDevice) setSelection(src dataSource) error {
+	s, ok := src.(*wlrSource)
+	if !ok {
+		return errors.New("data source is not a wlr data source")
+	}
+	return d.proxy.SetSelection(s.proxy)
+}
+
+func (d *wlrDevice) setPrimarySelection(src dataSource) error {
+	// the request is a protocol error before version 2
+	if !d.primary {
+		return errNoPrimary
+	}
+	s, ok := src.(*wlrSource)
+	if !ok {
+		return errors.New("data source is not a wlr data source")
+	}
+	return d.proxy.SetPrimarySelection(s.proxy)
+}
+
+func (d *wlrDevice) HandleZwlrDataControlDeviceV1DataOffer(
+	e wlr.ZwlrDataControlDeviceV1DataOfferEvent,
+) {
+	d.h.handleDataOffer(wlrOffer{e.Id})
+}
+
+func (d *wlrDevice) HandleZwlrDataControlDeviceV1Selection(
+	e wlr.ZwlrDataControlDeviceV1SelectionEvent,
+) {
+	if e.Id == nil {
+		d.h.handleSelection(nil)
+		return
+	}
+	d.h.handleSelection(wlrOffer{e.Id})
+}
+
+func (d *wlrDevice) HandleZwlrDataControlDeviceV1PrimarySelection(
+	e wlr.ZwlrDataControlDeviceV1PrimarySelectionEvent,
+) {
+	if e.Id == nil {
+		d.h.handlePrimarySelection(nil)
+		return
+	}
+	d.h.handlePrimarySelection(wlrOffer{e.Id})
+}
+
+func (d *wlrDevice) HandleZwlrDataControlDeviceV1Finished(
+	wlr.ZwlrDataControlDeviceV1FinishedEvent,
+) {
+	d.h.handleFinished()
+}
+
+type wlrSource struct {
+	proxy *wlr.ZwlrDataControlSourceV1
+	h     sourceHandler
+}
+
+func (s *wlrSource) offer(mimeType string) error { return s.proxy.Offer(mimeType) }
+func (s *wlrSource) destroy() error              { return s.proxy.Destroy() }
+
+func (s *wlrSource) HandleZwlrDataControlSourceV1Send(
+	e wlr.ZwlrDataControlSourceV1SendEvent,
+) {
+	s.h.handleSend(e.MimeType, e.Fd, e.FdError)
+}
+
+func (s *wlrSource) HandleZwlrDataControlSourceV1Cancelled(
+	wlr.ZwlrDataControlSourceV1CancelledEvent,
+) {
+	s.h.handleCancelled()
+}
+
+type wlrOffer struct {
+	proxy *wlr.ZwlrDataControlOfferV1
+}
+
+func (o wlrOffer) id() wl.ProxyId { return o.proxy.Id() }
+func (o wlrOffer) destroy() error { return o.proxy.Destroy() }
+
+func (o wlrOffer) receive(mimeType string, fd uintptr) error {
+	return o.proxy.Receive(mimeType, fd)
+}
+
+func (o wlrOffer) addOfferHandler(h offerHandler) {
+	o.proxy.AddOfferHandler(wlrOfferHandler{h})
+}
+
+type wlrOfferHandler struct {
+	h offerHandler
+}
+
+func (o wlrOfferHandler) HandleZwlrDataControlOfferV1Offer(
+	e wlr.ZwlrDataControlOfferV1OfferEvent,
+) {
+	o.h.handleOffer(e.MimeType)
+}
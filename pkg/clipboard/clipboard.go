@@ -7,46 +7,84 @@ import (
 	"log/slog"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	protocol "github.com/Nadim147c/yankd/internal/wlr-data-control-unstable-v1"
 	"github.com/neurlang/wayland/wl"
 	"github.com/neurlang/wayland/wlclient"
 )
 
-// InterfaceName is the wlr-data-control-unstable-v1 interface name
-const InterfaceName = "zwlr_data_control_manager_v1"
-
 type mimeHandler struct {
 	mu    sync.Mutex
 	mimes []string
 }
 
-func (h *mimeHandler) HandleZwlrDataControlOfferV1Offer(
-	e protocol.ZwlrDataControlOfferV1OfferEvent,
-) {
+func (h *mimeHandler) handleOffer(mimeType string) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.mimes = append(h.mimes, e.MimeType)
-	slog.Debug("mime type added", "mime", e.MimeType, "total", len(h.mimes))
+	h.mimes = append(h.mimes, mimeType)
+	slog.Debug("mime type added", "mime", mimeType, "total", len(h.mimes))
+}
+
+// Options configures the clipboard watcher
+type Options struct {
+	// Persist takes ownership of the selection when it is cleared, e.g. when
+	// the source application exits.
+	Persist bool
+	// Primary records the primary selection along with the clipboard.
+	Primary bool
+	// Latest returns the clip to serve when the selection is persisted.
+	Latest func() (Clip, error)
+	// MaxRetries is the number of consecutive failures after which
+	// WatchRetry gives up. Zero retries forever.
+	MaxRetries int
+	// ReadTimeout is the default timeout for reading an offered MIME type.
+	ReadTimeout time.Duration
+	// MaxSize is the default max size of an offered MIME type in bytes.
+	MaxSize int64
+	// Limits overrides ReadTimeout and MaxSize for matching MIME types.
+	Limits []Limit
+	// SpillDir is where data larger than the max size is streamed into.
+	// Oversized data is skipped if it is empty.
+	SpillDir string
+	// SensitiveMimes are path.Match patterns of hint MIME types. Offers with
+	// any matching MIME type are never recorded.
+	SensitiveMimes []string
 }
 
+const (
+	// minRetryDelay is the delay before the first reconnection attempt
+	minRetryDelay = 500 * time.Millisecond
+	// maxRetryDelay caps the exponential backoff between attempts
+	maxRetryDelay = 30 * time.Second
+)
+
 // Client is wayland that handle wayland clipboard protocol
 type Client struct {
-	display       *wl.Display
-	registry      *wl.Registry
-	manager       *protocol.ZwlrDataControlManagerV1
-	clips         chan<- Clip
-	seatGlobals   map[uint32]uint32
-	deviceName    uint32
-	deviceVersion uint32
-	closed        atomic.Bool
+	display        *wl.Display
+	registry       *wl.Registry
+	backend        backend
+	seats          map[uint32]*seat
+	clips          chan<- Clip
+	opts           Options
+	seatGlobals    map[uint32]uint32
+	managerGlobals map[string]global // interface -> global
+	closed         atomic.Bool
+}
+
+// global is a global advertised by the registry
+type global struct {
+	name    uint32
+	version uint32
 }
 
 // NewClient creates a new wayland client
-func NewClient(clips chan<- Clip) *Client {
+func NewClient(clips chan<- Clip, opts Options) *Client {
 	c := new(Client)
 	c.seatGlobals = make(map[uint32]uint32)
+	c.seats = make(map[uint32]*seat)
+	c.managerGlobals = make(map[string]global)
 	c.clips = clips
+	c.opts = opts
 	slog.Debug("clipboard client created")
 	return c
 }
@@ -54,70 +92,14 @@ func NewClient(clips chan<- Clip) *Client {
 // Close closes the underlying socket connection.
 func (h *Client) Close() error {
 	h.closed.Store(true)
-	return h.display.Context().Close()
-}
-
-// HandleZwlrDataControlDeviceV1DataOffer handles whenever new clipboard is
-// offered.
-func (h *Client) HandleZwlrDataControlDeviceV1DataOffer(
-	e protocol.ZwlrDataControlDeviceV1DataOfferEvent,
-) {
-	slog.Debug("data offer received", "offer_id", e.Id.Id())
-
-	collector := &mimeHandler{}
-	e.Id.AddOfferHandler(collector)
-
-	if err := wlclient.DisplayRoundtrip(h.display); err != nil {
-		if !h.closed.Load() {
-			slog.Error(
-				"registry roundtrip failed",
-				"error", err,
-				"closed-attempt", h.closed.Load(),
-			)
-		}
-		return
+	if h.display == nil {
+		return nil
 	}
-
-	slog.Info(
-		"mime types collected",
-		"offer_id", e.Id.Id(),
-		"count", len(collector.mimes),
-		"mimes", collector.mimes,
-	)
-
-	parser := newClipboardParser(e.Id, collector.mimes)
-	clip, err := parser.Parse()
-	if err != nil {
-		slog.Error(
-			"failed to parse clipboard content",
-			"offer_id", e.Id.Id(),
-			"error", err,
-		)
-		return
-	}
-
-	slog.Debug("clipboard content parsed successfully", "offer_id", e.Id.Id())
-	h.clips <- clip
-}
-
-// HandleZwlrDataControlDeviceV1Selection handles selection changes. Currently
-// does nothing!
-func (h *Client) HandleZwlrDataControlDeviceV1Selection(
-	protocol.ZwlrDataControlDeviceV1SelectionEvent,
-) {
-	slog.Debug("selection changed")
-}
-
-// HandleZwlrDataControlDeviceV1PrimarySelection handles primary selection
-// changes. Currently does nothing!
-func (h *Client) HandleZwlrDataControlDeviceV1PrimarySelection(
-	protocol.ZwlrDataControlDeviceV1PrimarySelectionEvent,
-) {
-	slog.Debug("primary selection changed")
+	return h.display.Context().Close()
 }
 
-// HandleRegistryGlobal handles wl_seat and zwlr_data_control_manager_v1
-// added.
+// HandleRegistryGlobal handles wl_seat and data control managers added. Seats
+// added after connecting are bound right away.
 func (h *Client) HandleRegistryGlobal(ev wl.RegistryGlobalEvent) {
 	if ev.Interface == "wl_seat" {
 		h.seatGlobals[ev.Name] = ev.Version
@@ -126,16 +108,21 @@ func (h *Client) HandleRegistryGlobal(ev wl.RegistryGlobalEvent) {
 			"name", ev.Name,
 			"version", ev.Version,
 		)
+		if h.backend != nil {
+			h.addSeat(ev.Name, ev.Version)
+		}
 	}
 
-	if ev.Interface == InterfaceName {
-		h.deviceName = ev.Name
-		h.deviceVersion = ev.Version
-		slog.Debug(
-			"zwlr_data_control_manager_v1 global registered",
-			"name", ev.Name,
-			"version", ev.Version,
-		)
+	for _, b := range backends {
+		if ev.Interface == b.iface {
+			h.managerGlobals[ev.Interface] = global{ev.Name, ev.Version}
+			slog.Debug(
+				"data control manager global registered",
+				"interface", ev.Interface,
+				"name", ev.Name,
+				"version", ev.Version,
+			)
+		}
 	}
 }
 
@@ -145,21 +132,63 @@ func (h *Client) HandleRegistryGlobalRemove(ev wl.RegistryGlobalRemoveEvent) {
 		delete(h.seatGlobals, ev.Name)
 		slog.Debug("wl_seat global removed", "name", ev.Name)
 	}
+
+	if s, exists := h.seats[ev.Name]; exists {
+		delete(h.seats, ev.Name)
+		s.release()
+	}
 }
 
-// Watch watches for clipboard changes and send new clips to given channel.
-func Watch(ctx context.Context, clips chan<- Clip) error {
-	slog.Info("starting clipboard watch")
+// addSeat binds the wl_seat global. The data device of the seat is watched
+// when the client is watching for clipboard changes.
+func (h *Client) addSeat(global, version uint32) {
+	s := &seat{
+		client: h,
+		global: global,
+		offers: make(map[dataOffer]*mimeHandler),
+	}
+	s.proxy = wlclient.RegistryBindSeatInterface(h.registry, global, version)
+	s.proxy.AddNameHandler(s)
+	h.seats[global] = s
+	slog.Debug("bound to wl_seat", "id", global, "version", version)
+
+	if h.clips == nil {
+		return
+	}
 
-	client := NewClient(clips)
+	if err := s.watch(); err != nil {
+		slog.Error("failed to watch wl_seat", "id", global, "error", err)
+	}
+}
+
+// findSeat returns the seat with given name. The seat with lowest global name
+// is returned if name is empty.
+func (h *Client) findSeat(name string) (*seat, error) {
+	var found *seat
+	for _, s := range h.seats {
+		if name != "" && s.name == name {
+			return s, nil
+		}
+		if name == "" && (found == nil || s.global < found.global) {
+			found = s
+		}
+	}
 
+	if found == nil {
+		return nil, fmt.Errorf("no wl_seat found with name %q", name)
+	}
+	return found, nil
+}
+
+// connect connects to the wayland display and binds to the preferred data
+// control manager and every wl_seat.
+func (h *Client) connect() error {
 	display, err := wlclient.DisplayConnect(nil)
 	if err != nil {
 		slog.Error("failed to connect to wayland display", "error", err)
 		return err
 	}
-	defer display.Context().Close()
-	client.display = display
+	h.display = display
 	slog.Debug("connected to wayland display")
 
 	registry, err := display.GetRegistry()
@@ -167,71 +196,87 @@ func Watch(ctx context.Context, clips chan<- Clip) error {
 		slog.Error("failed to get registry", "error", err)
 		return err
 	}
-	defer registry.Context().Close()
-	client.registry = registry
+	h.registry = registry
 	slog.Debug("got wayland registry")
 
-	wlclient.RegistryAddListener(registry, client)
+	wlclient.RegistryAddListener(registry, h)
 	if err := wlclient.DisplayRoundtrip(display); err != nil {
 		slog.Error("registry roundtrip failed", "error", err)
 		return fmt.Errorf("registry roundtrip failed: %w", err)
 	}
 
-	var seat *wl.Seat
-	for id, ver := range client.seatGlobals {
-		seat = wlclient.RegistryBindSeatInterface(registry, id, ver)
-		slog.Debug("bound to wl_seat", "id", id, "version", ver)
+	if len(h.seatGlobals) == 0 {
+		slog.Error("no wl_seat global found")
+		return errors.New("no wl_seat global found")
+	}
+
+	for _, b := range backends {
+		g, ok := h.managerGlobals[b.iface]
+		if !ok {
+			continue
+		}
+
+		bound, err := b.bind(registry, g.name, g.version)
+		if err != nil {
+			slog.Error("failed to bind", "interface", b.iface, "error", err)
+			return err
+		}
+		h.backend = bound
+		slog.Debug("bound to data control manager", "interface", b.iface)
+		if h.opts.Primary && !bound.primary() {
+			slog.Warn(
+				"primary selection is not supported, recording clipboard only",
+				"interface", b.iface,
+				"version", g.version,
+			)
+		}
 		break
 	}
 
-	if seat == nil {
-		slog.Error("no wl_seat global found")
-		return errors.New("no wl_seat global found")
+	if h.backend == nil {
+		slog.Error("no data control manager global found")
+		return errors.New("no data control manager global found")
 	}
-	defer seat.Context().Close()
 
-	manager := protocol.NewZwlrDataControlManagerV1(display.Context())
-	err = registry.Bind(
-		client.deviceName,
-		"zwlr_data_control_manager_v1",
-		client.deviceVersion,
-		manager,
-	)
-	if err != nil {
-		slog.Error("failed to bind zwlr_data_control_manager_v1", "error", err)
-		return err
+	for id, ver := range h.seatGlobals {
+		h.addSeat(id, ver)
 	}
-	slog.Debug("bound to zwlr_data_control_manager_v1")
 
+	// receive seat names
 	if err := wlclient.DisplayRoundtrip(display); err != nil {
 		slog.Error("registry roundtrip failed", "error", err)
 		return fmt.Errorf("registry roundtrip failed: %w", err)
 	}
 
-	if manager == nil {
-		slog.Error("zwlr_data_control_manager_v1 is nil after binding")
-		return errors.New("no zwlr_data_control_manager_v1 global found")
-	}
+	return nil
+}
 
-	device, err := manager.GetDataDevice(seat)
-	if err != nil {
-		slog.Error("failed to get data device", "error", err)
+// Watch watches for clipboard changes and send new clips to given channel.
+func Watch(ctx context.Context, clips chan<- Clip, opts Options) error {
+	slog.Info(
+		"starting clipboard watch",
+		"persist", opts.Persist,
+		"primary", opts.Primary,
+	)
+
+	client := NewClient(clips, opts)
+	defer client.Close()
+
+	if err := client.connect(); err != nil {
 		return err
 	}
-	slog.Debug("got data device")
-
-	device.AddDataOfferHandler(client)
-	device.AddSelectionHandler(client)
-	device.AddPrimarySelectionHandler(client)
-	slog.Debug("event handlers registered")
 
-	slog.Info("clipboard watch initialized, listening for changes")
+	slog.Info(
+		"clipboard watch initialized, listening for changes",
+		"seats", len(client.seats),
+	)
 
-	go func() {
-		<-ctx.Done()
+	// the dispatch loop is unblocked by closing the connection
+	stop := context.AfterFunc(ctx, func() {
 		slog.Info("context cancelled → attempting clean close")
 		client.Close()
-	}()
+	})
+	defer stop()
 
 	for {
 		select {
@@ -239,7 +284,12 @@ func Watch(ctx context.Context, clips chan<- Clip) error {
 			slog.Info("clipboard watch context cancelled")
 			return ctx.Err()
 		default:
-			err := wlclient.DisplayDispatch(display)
+			err := wlclient.DisplayDispatch(client.display)
+			// The device of a removed seat is destroyed before the finished
+			// event of the compositor arrives, which then has no proxy.
+			if errors.Is(err, wl.ErrContextRunProxyNil) {
+				continue
+			}
 			if err != nil && !client.closed.Load() {
 				slog.Error("dispatch failed", "error", err)
 				return fmt.Errorf("dispatch failed: %w", err)
@@ -247,3 +297,44 @@ func Watch(ctx context.Context, clips chan<- Clip) error {
 		}
 	}
 }
+
+// WatchRetry runs Watch and reconnects with exponential backoff whenever the
+// watcher fails, e.g. when the compositor restarts. It returns when ctx is
+// cancelled, or after opts.MaxRetries consecutive failures.
+func WatchRetry(ctx context.Context, clips chan<- Clip, opts Options) error {
+	delay := minRetryDelay
+	failures := 0
+	for {
+		start := time.Now()
+		err := Watch(ctx, clips, opts)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// a watcher which ran for a while isn't a consecutive failure
+		if time.Since(start) > maxRetryDelay {
+			delay = minRetryDelay
+			failures = 0
+		}
+
+		failures++
+		if opts.MaxRetries > 0 && failures > opts.MaxRetries {
+			slog.Error("clipboard watch failed, giving up", "failures", failures)
+			return fmt.Errorf("clipboard watch failed %d times: %w", failures, err)
+		}
+
+		slog.Error(
+			"clipboard watch failed, reconnecting",
+			"error", err,
+			"failures", failures,
+			"delay", delay,
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
@@ -0,0 +1,383 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/yankd/internal/wltest"
+)
+
+// testTimeout limits waiting for the watcher in tests
+const testTimeout = 5 * time.Second
+
+// eachBackend runs test with a fake compositor advertising each data control
+// manager. The compositor has a seat named seat0.
+func eachBackend(
+	t *testing.T,
+	test func(t *testing.T, comp *wltest.Compositor),
+) {
+	for _, manager := range []string{
+		wltest.ExtDataControl,
+		wltest.WlrDataControl,
+	} {
+		t.Run(manager, func(t *testing.T) {
+			comp, err := wltest.New(t.TempDir(), manager)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { comp.Close() })
+			t.Setenv("XDG_RUNTIME_DIR", comp.RuntimeDir())
+			t.Setenv("WAYLAND_DISPLAY", comp.Display())
+
+			comp.AddSeat("seat0")
+			test(t, comp)
+		})
+	}
+}
+
+// watch starts watching with opts until the test ends.
+func watch(t *testing.T, opts Options) <-chan Clip {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	clips := make(chan Clip)
+	done := make(chan error, 1)
+	go func() { done <- Watch(ctx, clips, opts) }()
+
+	t.Cleanup(func() {
+		cancel()
+		for {
+			select {
+			case <-clips:
+			case err := <-done:
+				if err != nil && !errors.Is(err, context.Canceled) {
+					t.Errorf("Watch() error: %v", err)
+				}
+				return
+			}
+		}
+	})
+	return clips
+}
+
+// offerText offers text as the selection of seat0.
+func offerText(
+	t *testing.T,
+	comp *wltest.Compositor,
+	sel wltest.Selection,
+	text string,
+) {
+	t.Helper()
+	err := comp.Offer("seat0", sel, wltest.Payload{
+		Mime: "text/plain",
+		Data: []byte(text),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receiveClip waits for the next clip.
+func receiveClip(t *testing.T, clips <-chan Clip) Clip {
+	t.Helper()
+	select {
+	case clip := <-clips:
+		return clip
+	case <-time.After(testTimeout):
+		t.Fatal("no clip received")
+		return Clip{}
+	}
+}
+
+// expectText waits for the next clip and checks its text.
+func expectText(t *testing.T, clips <-chan Clip, text string) Clip {
+	t.Helper()
+	clip := receiveClip(t, clips)
+	if clip.Text != text {
+		t.Fatalf("clip text = %q, want %q", clip.Text, text)
+	}
+	return clip
+}
+
+func TestWatch(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{})
+
+		err := comp.Offer("seat0", wltest.Clipboard,
+			wltest.Payload{Mime: "text/html", Data: []byte("<b>hello</b>")},
+			wltest.Payload{Mime: "text/plain", Data: []byte("hello")},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clip := expectText(t, clips, "hello")
+		if clip.Mime != "text/plain" {
+			t.Errorf("clip mime = %q, want text/plain", clip.Mime)
+		}
+		if clip.Seat != "seat0" || clip.Selection != SelectionClipboard {
+			t.Errorf(
+				"clip from %s of %q, want clipboard of seat0",
+				clip.Selection, clip.Seat,
+			)
+		}
+		var mimes []string
+		for _, rep := range clip.Representations {
+			mimes = append(mimes, rep.Mime)
+		}
+		want := []string{"text/html", "text/plain"}
+		if !slices.Equal(mimes, want) {
+			t.Errorf("representations = %v, want %v", mimes, want)
+		}
+	})
+}
+
+func TestWatchRepresentations(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{})
+
+		err := comp.Offer("seat0", wltest.Clipboard,
+			wltest.Payload{Mime: "application/x-office", Data: []byte("doc")},
+			wltest.Payload{Mime: "image/bmp", Data: []byte("bmp")},
+			wltest.Payload{Mime: "image/tiff", Data: []byte("tiff")},
+			wltest.Payload{Mime: "application/rtf", Data: []byte("rtf")},
+			wltest.Payload{Mime: "text/plain", Data: []byte("hello")},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// only the first image and known types are stored besides text
+		clip := expectText(t, clips, "hello")
+		var mimes []string
+		for _, rep := range clip.Representations {
+			mimes = append(mimes, rep.Mime)
+		}
+		want := []string{"image/bmp", "application/rtf", "text/plain"}
+		if !slices.Equal(mimes, want) {
+			t.Errorf("representations = %v, want %v", mimes, want)
+		}
+	})
+}
+
+func TestWatchPrimary(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{})
+
+		// the primary selection is ignored unless enabled
+		offerText(t, comp, wltest.Primary, "selected")
+		offerText(t, comp, wltest.Clipboard, "copied")
+		expectText(t, clips, "copied")
+	})
+
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{Primary: true})
+
+		offerText(t, comp, wltest.Primary, "selected")
+		clip := expectText(t, clips, "selected")
+		if clip.Selection != SelectionPrimary {
+			t.Errorf("clip selection = %s, want primary", clip.Selection)
+		}
+	})
+}
+
+func TestWlrPrimaryUnsupported(t *testing.T) {
+	comp, err := wltest.New(t.TempDir(), wltest.WlrDataControl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { comp.Close() })
+	t.Setenv("XDG_RUNTIME_DIR", comp.RuntimeDir())
+	t.Setenv("WAYLAND_DISPLAY", comp.Display())
+	comp.SetVersion(wltest.WlrDataControl, 1)
+	comp.AddSeat("seat0")
+
+	// version 1 has no primary selection, the clipboard is still recorded
+	clips := watch(t, Options{Primary: true})
+	offerText(t, comp, wltest.Clipboard, "copied")
+	expectText(t, clips, "copied")
+
+	clip := Clip{Mime: "text/plain", Text: "hello"}
+	err = Set(t.Context(), clip, SelectionPrimary, "seat0")
+	if !errors.Is(err, errNoPrimary) {
+		t.Errorf("Set() error = %v, want %v", err, errNoPrimary)
+	}
+}
+
+func TestWatchPersist(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		latest := Clip{Mime: "text/plain", Text: "kept"}
+		clips := watch(t, Options{
+			Persist: true,
+			Latest:  func() (Clip, error) { return latest, nil },
+		})
+
+		offerText(t, comp, wltest.Clipboard, "hello")
+		expectText(t, clips, "hello")
+
+		// the source application exits
+		if err := comp.Clear("seat0", wltest.Clipboard); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(t.Context(), testTimeout)
+		defer cancel()
+		src, err := comp.WaitSource(ctx, "seat0", wltest.Clipboard)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mimes := src.Mimes()
+		for _, mime := range []string{"text/plain", persistMime} {
+			if !slices.Contains(mimes, mime) {
+				t.Errorf("persisted mimes = %v, want %s", mimes, mime)
+			}
+		}
+		data, err := src.Receive("text/plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "kept" {
+			t.Errorf("persisted text = %q, want %q", data, "kept")
+		}
+
+		// the persisted selection is not recorded again
+		offerText(t, comp, wltest.Clipboard, "next")
+		expectText(t, clips, "next")
+	})
+}
+
+func TestWatchSeats(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{})
+		offerText(t, comp, wltest.Clipboard, "first")
+		expectText(t, clips, "first")
+
+		comp.AddSeat("seat1")
+		err := comp.Offer("seat1", wltest.Clipboard, wltest.Payload{
+			Mime: "text/plain",
+			Data: []byte("other seat"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		clip := expectText(t, clips, "other seat")
+		if clip.Seat != "seat1" {
+			t.Errorf("clip seat = %q, want seat1", clip.Seat)
+		}
+
+		// the watcher keeps watching the other seats
+		comp.RemoveSeat("seat1")
+		offerText(t, comp, wltest.Clipboard, "after remove")
+		expectText(t, clips, "after remove")
+	})
+}
+
+func TestWatchReadTimeout(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{
+			ReadTimeout: 50 * time.Millisecond,
+			Limits: []Limit{
+				{Mime: "image/*", Timeout: testTimeout},
+			},
+		})
+
+		err := comp.Offer("seat0", wltest.Clipboard, wltest.Payload{
+			Mime:  "text/plain",
+			Data:  []byte("slow"),
+			Delay: time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the limit of the mime type overrides the read timeout
+		err = comp.Offer("seat0", wltest.Clipboard, wltest.Payload{
+			Mime:  "image/png",
+			Data:  []byte("png"),
+			Delay: 200 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the slow text is never recorded
+		clip := receiveClip(t, clips)
+		if clip.Mime != "image/png" || string(clip.Blob) != "png" {
+			t.Errorf(
+				"clip = %s %q, want image/png %q", clip.Mime, clip.Blob, "png",
+			)
+		}
+	})
+}
+
+func TestWatchMaxSize(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{MaxSize: 4})
+
+		// oversized data is skipped without a spill directory
+		offerText(t, comp, wltest.Clipboard, "too large")
+		offerText(t, comp, wltest.Clipboard, "ok")
+		expectText(t, clips, "ok")
+	})
+
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		spillDir := filepath.Join(t.TempDir(), "spill")
+		clips := watch(t, Options{MaxSize: 4, SpillDir: spillDir})
+
+		offerText(t, comp, wltest.Clipboard, "too large")
+		clip := receiveClip(t, clips)
+		if filepath.Dir(clip.BlobPath) != spillDir {
+			t.Fatalf("clip blob = %q, want file in %s", clip.BlobPath, spillDir)
+		}
+		// the start of the text is kept for searching
+		if clip.Text != "too " {
+			t.Errorf("clip text = %q, want %q", clip.Text, "too ")
+		}
+
+		data, err := os.ReadFile(clip.BlobPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "too large" {
+			t.Errorf("spilled data = %q, want %q", data, "too large")
+		}
+		for path, want := range map[string]os.FileMode{
+			spillDir:      0o700,
+			clip.BlobPath: 0o600,
+		} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != want {
+				t.Errorf("%s mode = %v, want %v", path, perm, want)
+			}
+		}
+	})
+}
+
+func TestWatchSensitive(t *testing.T) {
+	eachBackend(t, func(t *testing.T, comp *wltest.Compositor) {
+		clips := watch(t, Options{
+			SensitiveMimes: []string{"x-kde-passwordManagerHint"},
+		})
+
+		err := comp.Offer("seat0", wltest.Clipboard,
+			wltest.Payload{Mime: "text/plain", Data: []byte("hunter2")},
+			wltest.Payload{
+				Mime: "x-kde-passwordManagerHint",
+				Data: []byte("secret"),
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offerText(t, comp, wltest.Clipboard, "public")
+		expectText(t, clips, "public")
+	})
+}
@@ -0,0 +1,71 @@
+package clipboard
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Limit limits reading the data of offered MIME types matching a pattern.
+// Zero timeout or size falls back to the defaults of the options.
+type Limit struct {
+	// Mime is a path.Match pattern, e.g. image/*
+	Mime    string
+	Timeout time.Duration
+	MaxSize int64
+}
+
+// ParseLimit parses a limit in the form of PATTERN=TIMEOUT,SIZE, e.g.
+// image/*=30s,256MiB. Either timeout or size can be left empty.
+func ParseLimit(s string) (Limit, error) {
+	pattern, value, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" {
+		return Limit{}, fmt.Errorf("invalid limit %q: expected MIME=TIMEOUT,SIZE", s)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return Limit{}, fmt.Errorf("invalid mime pattern %q: %w", pattern, err)
+	}
+
+	limit := Limit{Mime: pattern}
+	timeout, size, _ := strings.Cut(value, ",")
+
+	if timeout = strings.TrimSpace(timeout); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return limit, fmt.Errorf("invalid timeout in limit %q: %w", s, err)
+		}
+		limit.Timeout = d
+	}
+
+	if size = strings.TrimSpace(size); size != "" {
+		n, err := humanize.ParseBytes(size)
+		if err != nil {
+			return limit, fmt.Errorf("invalid size in limit %q: %w", s, err)
+		}
+		limit.MaxSize = int64(n)
+	}
+
+	return limit, nil
+}
+
+// limitFor returns the read timeout and max size for the MIME type. The first
+// matching limit is used, zero means no limit.
+func (o Options) limitFor(mimeType string) (time.Duration, int64) {
+	timeout, maxSize := o.ReadTimeout, o.MaxSize
+	for _, limit := range o.Limits {
+		if ok, _ := path.Match(limit.Mime, mimeType); !ok {
+			continue
+		}
+		if limit.Timeout != 0 {
+			timeout = limit.Timeout
+		}
+		if limit.MaxSize != 0 {
+			maxSize = limit.MaxSize
+		}
+		break
+	}
+	return timeout, maxSize
+}
@@ -1,9 +1,13 @@
 package clipboard
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"strconv"
 	"time"
 
@@ -60,27 +64,83 @@ func (h *Hash) Scan(value any) error {
 	}
 }
 
+// Selection is the wayland selection a clip is copied from
+type Selection string
+
+const (
+	// SelectionClipboard is the regular clipboard selection
+	SelectionClipboard Selection = "clipboard"
+	// SelectionPrimary is the primary selection, pasted with middle-click
+	SelectionPrimary Selection = "primary"
+)
+
 // HashClip returns uint64 hash for clip content
 func HashClip(clip Clip) Hash {
 	w := xxhash.New()
-	w.WriteString(clip.Mime)
-	w.WriteString(clip.Text)
-	w.WriteString(clip.Metadata)
-	w.WriteString(clip.URL)
-	w.Write(clip.Blob)
+	writeClip(w, clip)
 	return Hash(w.Sum64())
 }
 
+// HashClipKeyed returns the hash of clip content keyed with HMAC-SHA256, which
+// can't be computed from the content without the key.
+func HashClipKeyed(key []byte, clip Clip) Hash {
+	w := hmac.New(sha256.New, key)
+	writeClip(w, clip)
+	return Hash(binary.BigEndian.Uint64(w.Sum(nil)))
+}
+
+// writeClip writes the hashed content of clip to w.
+func writeClip(w io.Writer, clip Clip) {
+	// only primary clips are hashed with selection, this keeps hashes of the
+	// clips recorded before selection was introduced stable
+	if clip.Selection == SelectionPrimary {
+		io.WriteString(w, string(clip.Selection))
+	}
+	io.WriteString(w, clip.Mime)
+	io.WriteString(w, clip.Text)
+	io.WriteString(w, clip.Metadata)
+	io.WriteString(w, clip.URL)
+	w.Write(clip.Blob)
+	// blob is moved to the blob store before hashing, so it is identified by
+	// its hash
+	if clip.BlobHash != 0 {
+		io.WriteString(w, clip.BlobHash.String())
+	}
+}
+
 // Clip is a single clipboard item
 type Clip struct {
-	ID       uint      `json:"id"`
-	Time     time.Time `json:"time"`
-	Hash     Hash      `json:"hash"                gorm:"index:,unique,length:16"`
-	Text     string    `json:"text"`
-	Mime     string    `json:"mime"`
-	Metadata string    `json:"metadata"`
-	URL      string    `json:"url,omitempty"`
-	Blob     []byte    `json:"blob,omitempty"`
-	BlobPath string    `json:"blob_path,omitempty"`
-	BlobHash Hash      `json:"blob_hash,omitempty" gorm:"index:,length:16"`
+	ID        uint      `json:"id"`
+	Time      time.Time `json:"time"`
+	LastUsed  time.Time `json:"last_used"           gorm:"index"`
+	CopyCount int       `json:"copy_count"          gorm:"default:1"`
+	Selection Selection `json:"selection"           gorm:"index;default:clipboard"`
+	Seat      string    `json:"seat,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"    gorm:"index;default:false"`
+	Hash      Hash      `json:"hash"                gorm:"index:,unique,length:16"`
+	Text      string    `json:"text"`
+	Mime      string    `json:"mime"`
+	Metadata  string    `json:"metadata"`
+	URL       string    `json:"url,omitempty"`
+	Blob      []byte    `json:"blob,omitempty"`
+	BlobPath  string    `json:"blob_path,omitempty"`
+	BlobHash  Hash      `json:"blob_hash,omitempty" gorm:"index:,length:16"`
+
+	Representations []Representation `json:"representations,omitempty"`
+
+	// Snippet is the part of the clip matching a search query
+	Snippet string `json:"snippet,omitempty" gorm:"->;-:migration"`
+	// Sealed is set if the text, metadata and url are stored encrypted
+	Sealed bool `json:"-" gorm:"default:false"`
+}
+
+// Representation is the content of a clip in one of the offered mime types
+type Representation struct {
+	ID       uint   `json:"id"`
+	ClipID   uint   `json:"clip_id"             gorm:"index"`
+	Mime     string `json:"mime"`
+	Size     int    `json:"size"`
+	Data     []byte `json:"-"                   gorm:"-"`
+	BlobPath string `json:"blob_path"`
+	BlobHash Hash   `json:"blob_hash"           gorm:"index:,length:16"`
 }
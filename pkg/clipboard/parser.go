@@ -7,13 +7,17 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path"
 	"slices"
 	"strings"
 	"time"
-
-	protocol "github.com/Nadim147c/yankd/internal/wlr-data-control-unstable-v1"
+	"unicode/utf8"
 )
 
+// spillTextSize is the size of the prefix of spilled text which is kept as
+// the text of the clip, so that it can be searched.
+const spillTextSize = 64 << 10
+
 // mimeCategory returns the category of a MIME type
 func mimeCategory(mimeType string) string {
 	parts := strings.Split(mimeType, "/")
@@ -28,13 +32,65 @@ func isImageMime(mimeType string) bool {
 	return mimeCategory(mimeType) == "image"
 }
 
+// representationMimes are path.Match patterns of the MIME types which are
+// stored as representations besides text and the first image. Applications
+// offer many other types, which are often large and rarely pasted.
+var representationMimes = []string{
+	"application/json",
+	"application/rtf",
+	"application/x-kde-cutselection",
+	"application/xml",
+	"chromium/x-source-url",
+	"x-special/gnome-copied-files",
+}
+
+// isRepresentationMime checks if MIME type should be stored as a
+// representation. X11 targets like UTF8_STRING or TARGETS aren't real MIME
+// types and only alias other representations. Images are checked by the
+// parser, since only the first one is stored.
+func isRepresentationMime(mimeType string) bool {
+	if mimeCategory(mimeType) == "text" {
+		return strings.Contains(mimeType, "/")
+	}
+	for _, pattern := range representationMimes {
+		if ok, _ := path.Match(pattern, mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
+
 type clipboardParser struct {
-	offer         *protocol.ZwlrDataControlOfferV1
+	offer         dataOffer
+	opts          Options
 	offeredMimes  []string
-	retrievedData map[string][]byte // mimeType -> data
+	retrievedData map[string][]byte      // mimeType -> data
+	spilledData   map[string]spilledFile // mimeType -> oversized data
 	selectedMimes selectedMimesType
 }
 
+// spilledFile is oversized data streamed into the spill directory
+type spilledFile struct {
+	path   string
+	size   int64
+	prefix []byte // at most spillTextSize bytes from the start of the data
+}
+
+// idleReader reads from a file which times out only if no data arrives for
+// timeout, instead of timing out after timeout in total.
+type idleReader struct {
+	file    *os.File
+	timeout time.Duration
+}
+
+func (r idleReader) Read(p []byte) (int, error) {
+	err := r.file.SetReadDeadline(time.Now().Add(r.timeout))
+	if err != nil {
+		return 0, err
+	}
+	return r.file.Read(p)
+}
+
 type selectedMimesType struct {
 	primary  string // preferred image or text mime
 	image    string
@@ -45,14 +101,17 @@ type selectedMimesType struct {
 
 // newClipboardParser creates a new parser for an offer
 func newClipboardParser(
-	offer *protocol.ZwlrDataControlOfferV1,
+	offer dataOffer,
 	mimes []string,
+	opts Options,
 ) *clipboardParser {
 	slog.Debug("creating clipboard parser", "offered_mimes_count", len(mimes))
 	return &clipboardParser{
 		offer:         offer,
+		opts:          opts,
 		offeredMimes:  mimes,
 		retrievedData: make(map[string][]byte),
+		spilledData:   make(map[string]spilledFile),
 	}
 }
 
@@ -70,11 +129,8 @@ func (cp *clipboardParser) selectMimes() {
 		"image/webp",
 		"image/gif",
 	}
-	textPriority := []string{
-		"text/plain;charset=utf-8",
-		"text/plain",
-		"text/html",
-	}
+	// plain text mime types are equivalent, the first offered is selected
+	plainText := []string{"text/plain;charset=utf-8", "text/plain"}
 	urlPriority := []string{"chromium/x-source-url", "text/x-moz-url"}
 
 	// Select image MIME
@@ -89,8 +145,8 @@ func (cp *clipboardParser) selectMimes() {
 
 	// Select text MIME (only if no image selected)
 	if cp.selectedMimes.primary == "" {
-		for _, candidate := range textPriority {
-			if slices.Contains(cp.offeredMimes, candidate) {
+		for _, candidate := range cp.offeredMimes {
+			if slices.Contains(plainText, candidate) {
 				cp.selectedMimes.text = candidate
 				cp.selectedMimes.primary = candidate
 				slog.Debug("selected text mime", "mime", candidate)
@@ -98,6 +154,12 @@ func (cp *clipboardParser) selectMimes() {
 			}
 		}
 	}
+	if cp.selectedMimes.primary == "" &&
+		slices.Contains(cp.offeredMimes, "text/html") {
+		cp.selectedMimes.text = "text/html"
+		cp.selectedMimes.primary = "text/html"
+		slog.Debug("selected text mime", "mime", "text/html")
+	}
 
 	// Fallback to text/plain if nothing selected
 	if cp.selectedMimes.primary == "" &&
@@ -155,6 +217,21 @@ func (cp *clipboardParser) getMimesToRetrieve() []string {
 		mimes = append(mimes, cp.selectedMimes.metadata)
 	}
 
+	// The other representations are retrieved after the selected ones, only
+	// the selected or the first offered image is retrieved
+	image := cp.selectedMimes.image
+	for _, mime := range cp.offeredMimes {
+		if image == "" && isImageMime(mime) {
+			image = mime
+		}
+		if mime != image && !isRepresentationMime(mime) {
+			continue
+		}
+		if !slices.Contains(mimes, mime) {
+			mimes = append(mimes, mime)
+		}
+	}
+
 	slog.Debug("mime types to retrieve", "count", len(mimes), "mimes", mimes)
 	return mimes
 }
@@ -177,7 +254,7 @@ func (cp *clipboardParser) retrieveData(mimeType string) error {
 	defer writeFd.Close()
 
 	// Send receive request
-	if err := cp.offer.Receive(mimeType, uintptr(writeFd.Fd())); err != nil {
+	if err := cp.offer.receive(mimeType, uintptr(writeFd.Fd())); err != nil {
 		readFd.Close()
 		slog.Error("receive request failed", "mime", mimeType, "error", err)
 		return fmt.Errorf("receive request failed for %s: %w", mimeType, err)
@@ -185,16 +262,38 @@ func (cp *clipboardParser) retrieveData(mimeType string) error {
 
 	// Close write end in this process
 	writeFd.Close()
+	defer readFd.Close()
+
+	timeout, maxSize := cp.opts.limitFor(mimeType)
+	if timeout > 0 {
+		err := readFd.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			slog.Error("failed to set read deadline", "mime", mimeType, "error", err)
+			return fmt.Errorf("failed to set read deadline for %s: %w", mimeType, err)
+		}
+	}
 
-	// Read data from the read end
-	data, err := io.ReadAll(readFd)
-	readFd.Close()
+	// Read one byte more than max size to know if the data is oversized
+	var r io.Reader = readFd
+	if maxSize > 0 {
+		r = io.LimitReader(readFd, maxSize+1)
+	}
 
+	// Read data from the read end
+	data, err := io.ReadAll(r)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		slog.Warn("reading data timed out", "mime", mimeType, "timeout", timeout)
+		return fmt.Errorf("reading %s timed out after %s", mimeType, timeout)
+	}
 	if err != nil {
 		slog.Error("failed to read data", "mime", mimeType, "error", err)
 		return fmt.Errorf("failed to read data for %s: %w", mimeType, err)
 	}
 
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return cp.spill(mimeType, data, readFd, timeout, maxSize)
+	}
+
 	cp.retrievedData[mimeType] = data
 	slog.Debug(
 		"data retrieved successfully",
@@ -204,6 +303,96 @@ func (cp *clipboardParser) retrieveData(mimeType string) error {
 	return nil
 }
 
+// spill streams oversized data into a file in the spill directory. The data
+// is skipped if spill directory is not set. Oversized data can take longer
+// than the read timeout, so the rest of the data only times out if the source
+// stops sending it.
+func (cp *clipboardParser) spill(
+	mimeType string,
+	head []byte,
+	file *os.File,
+	timeout time.Duration,
+	maxSize int64,
+) error {
+	if cp.opts.SpillDir == "" {
+		slog.Warn(
+			"skipping oversized data",
+			"mime", mimeType,
+			"max_size_bytes", maxSize,
+		)
+		return fmt.Errorf("data for %s exceeds max size of %d", mimeType, maxSize)
+	}
+
+	// spilled data is clipboard content, only the user may read it
+	if err := os.MkdirAll(cp.opts.SpillDir, 0o700); err != nil {
+		slog.Error("failed to create spill directory", "error", err)
+		return fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	// directories created by older versions are readable by everyone
+	if err := os.Chmod(cp.opts.SpillDir, 0o700); err != nil {
+		slog.Warn("failed to restrict spill directory", "error", err)
+	}
+
+	// temporary files are created with 0o600
+	out, err := os.CreateTemp(cp.opts.SpillDir, "spill-*")
+	if err != nil {
+		slog.Error("failed to create spill file", "error", err)
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+	defer out.Close()
+
+	var r io.Reader = file
+	if timeout > 0 {
+		r = idleReader{file: file, timeout: timeout}
+	}
+	n, err := io.Copy(out, io.MultiReader(bytes.NewReader(head), r))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		os.Remove(out.Name())
+		slog.Warn("spilling data timed out", "mime", mimeType, "timeout", timeout)
+		return fmt.Errorf("spilling %s timed out after %s", mimeType, timeout)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		slog.Error("failed to spill data", "mime", mimeType, "error", err)
+		return fmt.Errorf("failed to spill data for %s: %w", mimeType, err)
+	}
+
+	cp.spilledData[mimeType] = spilledFile{
+		path:   out.Name(),
+		size:   n,
+		prefix: head[:min(int64(len(head)), maxSize, spillTextSize)],
+	}
+	slog.Info(
+		"oversized data streamed to file",
+		"mime", mimeType,
+		"path", out.Name(),
+		"size_bytes", n,
+	)
+	return nil
+}
+
+// textPrefix returns the prefix of spilled text without a rune cut at the
+// end.
+func textPrefix(data []byte) string {
+	for range utf8.UTFMax - 1 {
+		r, size := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	return string(data)
+}
+
+// removeSpilled removes spilled files of a clip which won't be stored.
+func (cp *clipboardParser) removeSpilled() {
+	for _, f := range cp.spilledData {
+		if err := os.Remove(f.path); err != nil {
+			slog.Warn("failed to remove spill file", "path", f.path, "error", err)
+		}
+	}
+}
+
 // RetrieveAll fetches all selected MIME types
 func (cp *clipboardParser) RetrieveAll() error {
 	slog.Debug("retrieving all selected mime types")
@@ -257,6 +446,20 @@ func (cp *clipboardParser) Parse() (Clip, error) {
 		slog.Debug("mime type defaulted to text/plain")
 	}
 
+	_, retrieved := cp.retrievedData[cp.selectedMimes.primary]
+	spilled, isSpilled := cp.spilledData[cp.selectedMimes.primary]
+	if !retrieved && !isSpilled {
+		cp.removeSpilled()
+		slog.Error("failed to retrieve primary mime type", "mime", clip.Mime)
+		return clip, fmt.Errorf("failed to retrieve %s", clip.Mime)
+	}
+
+	// Oversized data is kept only as blob
+	if isSpilled {
+		clip.BlobPath = spilled.path
+		slog.Debug("spilled blob set", "size_bytes", spilled.size)
+	}
+
 	// Handle image data
 	if isImageMime(cp.selectedMimes.primary) {
 		slog.Debug("parsing image data", "mime", cp.selectedMimes.primary)
@@ -281,6 +484,11 @@ func (cp *clipboardParser) Parse() (Clip, error) {
 			clip.Text = string(data)
 			slog.Debug("text data set", "length", len(clip.Text))
 		}
+		// the start of oversized text is kept to find the clip by searching
+		if isSpilled {
+			clip.Text = textPrefix(spilled.prefix)
+			slog.Debug("text prefix set", "length", len(clip.Text))
+		}
 	}
 
 	// Get URL
@@ -292,14 +500,33 @@ func (cp *clipboardParser) Parse() (Clip, error) {
 		}
 	}
 
+	// Keep every retrieved representation in the offered order
+	for _, mime := range cp.offeredMimes {
+		if data, ok := cp.retrievedData[mime]; ok {
+			clip.Representations = append(clip.Representations, Representation{
+				Mime: mime,
+				Size: len(data),
+				Data: data,
+			})
+		}
+		if f, ok := cp.spilledData[mime]; ok {
+			clip.Representations = append(clip.Representations, Representation{
+				Mime:     mime,
+				Size:     int(f.size),
+				BlobPath: f.path,
+			})
+		}
+	}
+
 	slog.Info(
 		"clipboard parsed successfully",
-		"id", cp.offer.Id(),
+		"id", cp.offer.id(),
 		"mime", clip.Mime,
-		"has_blob", len(clip.Blob) > 0,
+		"has_blob", len(clip.Blob) > 0 || clip.BlobPath != "",
 		"has_text", len(clip.Text) > 0,
 		"has_url", len(clip.URL) > 0,
 		"has_metadata", len(clip.Metadata) > 0,
+		"representations", len(clip.Representations),
 	)
 
 	return clip, nil
@@ -0,0 +1,211 @@
+package clipboard
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/neurlang/wayland/wl"
+)
+
+// seat is a bound wl_seat with its own data control device
+type seat struct {
+	client *Client
+	global uint32 // name of the wl_seat global
+	name   string // name advertised by the wl_seat
+	proxy  *wl.Seat
+	device dataDevice
+	offers map[dataOffer]*mimeHandler
+}
+
+// HandleSeatName handles the name of the seat.
+func (s *seat) HandleSeatName(e wl.SeatNameEvent) {
+	s.name = e.Name
+	slog.Debug("wl_seat name received", "global", s.global, "seat", s.name)
+}
+
+// getDevice creates the data control device of the seat. Device events are
+// handled by the seat if handle is true.
+func (s *seat) getDevice(handle bool) error {
+	var h deviceHandler
+	if handle {
+		h = s
+	}
+	device, err := s.client.backend.getDevice(s.proxy, h)
+	if err != nil {
+		slog.Error("failed to get data device", "seat", s.name, "error", err)
+		return err
+	}
+	s.device = device
+	slog.Debug("got data device", "seat", s.name)
+	return nil
+}
+
+// watch registers the seat for data control device events.
+func (s *seat) watch() error {
+	if err := s.getDevice(true); err != nil {
+		return err
+	}
+	slog.Debug("event handlers registered", "seat", s.name)
+	return nil
+}
+
+// release destroys the data control device and releases the seat.
+func (s *seat) release() {
+	for offer := range s.offers {
+		s.destroyOffer(offer)
+	}
+
+	s.destroyDevice()
+
+	if err := s.proxy.Release(); err != nil {
+		slog.Debug("failed to release wl_seat", "seat", s.name)
+	}
+	s.client.display.Context().Unregister(s.proxy.Id())
+	slog.Debug("wl_seat released", "seat", s.name)
+}
+
+// handleDataOffer handles whenever new clipboard is offered. The offered mime
+// types are collected until the offer is advertised as a selection.
+func (s *seat) handleDataOffer(offer dataOffer) {
+	slog.Debug("data offer received", "seat", s.name, "offer_id", offer.id())
+
+	collector := &mimeHandler{}
+	offer.addOfferHandler(collector)
+	s.offers[offer] = collector
+}
+
+// receive parses the offer advertised as the given selection and sends the
+// clip to the clips channel.
+func (s *seat) receive(offer dataOffer, selection Selection) {
+	collector, ok := s.offers[offer]
+	if !ok {
+		slog.Warn(
+			"selection advertised for unknown offer",
+			"offer_id", offer.id(),
+		)
+		return
+	}
+	delete(s.offers, offer)
+	defer s.destroyOffer(offer)
+
+	slog.Info(
+		"mime types collected",
+		"seat", s.name,
+		"offer_id", offer.id(),
+		"selection", selection,
+		"count", len(collector.mimes),
+		"mimes", collector.mimes,
+	)
+
+	if slices.Contains(collector.mimes, persistMime) {
+		slog.Debug("skipping offer of persisted clip", "offer_id", offer.id())
+		return
+	}
+
+	if hint, ok := s.client.opts.sensitiveMime(collector.mimes); ok {
+		slog.Info(
+			"skipping offer marked as sensitive",
+			"offer_id", offer.id(),
+			"hint", hint,
+		)
+		return
+	}
+
+	parser := newClipboardParser(offer, collector.mimes, s.client.opts)
+	clip, err := parser.Parse()
+	if err != nil {
+		slog.Error(
+			"failed to parse clipboard content",
+			"offer_id", offer.id(),
+			"error", err,
+		)
+		return
+	}
+	clip.Selection = selection
+	clip.Seat = s.name
+
+	slog.Debug("clipboard content parsed successfully", "offer_id", offer.id())
+	s.client.clips <- clip
+}
+
+// destroyOffer destroys an offer which is no longer needed.
+func (s *seat) destroyOffer(offer dataOffer) {
+	delete(s.offers, offer)
+	if err := offer.destroy(); err != nil {
+		slog.Debug("failed to destroy offer", "offer_id", offer.id())
+	}
+	s.client.display.Context().Unregister(offer.id())
+}
+
+// handleSelection handles selection changes. An empty selection is taken over
+// with the latest clip if persist is enabled.
+func (s *seat) handleSelection(offer dataOffer) {
+	if offer != nil {
+		slog.Debug("selection changed", "seat", s.name, "offer_id", offer.id())
+		s.receive(offer, SelectionClipboard)
+		return
+	}
+
+	slog.Debug("selection cleared", "seat", s.name)
+	opts := s.client.opts
+	if !opts.Persist || opts.Latest == nil {
+		return
+	}
+
+	clip, err := opts.Latest()
+	if err != nil {
+		slog.Warn("failed to get latest clip to persist", "error", err)
+		return
+	}
+
+	_, err = s.setSelection(clip, SelectionClipboard, true)
+	if err != nil {
+		slog.Error("failed to persist selection", "seat", s.name, "error", err)
+		return
+	}
+	slog.Info(
+		"selection persisted",
+		"seat", s.name,
+		"id", clip.ID,
+		"mime", clip.Mime,
+	)
+}
+
+// handlePrimarySelection handles primary selection changes. The primary
+// selection is recorded only if enabled in options.
+func (s *seat) handlePrimarySelection(offer dataOffer) {
+	if offer == nil {
+		slog.Debug("primary selection cleared", "seat", s.name)
+		return
+	}
+
+	slog.Debug(
+		"primary selection changed",
+		"seat", s.name,
+		"offer_id", offer.id(),
+	)
+	if !s.client.opts.Primary {
+		s.destroyOffer(offer)
+		return
+	}
+	s.receive(offer, SelectionPrimary)
+}
+
+// handleFinished handles the data device becoming invalid, e.g. when the seat
+// is removed.
+func (s *seat) handleFinished() {
+	slog.Debug("data device finished", "seat", s.name)
+	s.destroyDevice()
+}
+
+// destroyDevice destroys the data control device of the seat.
+func (s *seat) destroyDevice() {
+	if s.device == nil {
+		return
+	}
+	if err := s.device.destroy(); err != nil {
+		slog.Debug("failed to destroy data device", "seat", s.name)
+	}
+	s.client.display.Context().Unregister(s.device.id())
+	s.device = nil
+}
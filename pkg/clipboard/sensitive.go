@@ -0,0 +1,32 @@
+package clipboard
+
+import (
+	"path"
+	"slices"
+)
+
+// DefaultSensitiveMimes are hint MIME types offered by password managers next
+// to copied secrets.
+var DefaultSensitiveMimes = []string{
+	// KeePassXC, Bitwarden, KDE apps and wl-copy --sensitive
+	"x-kde-passwordManagerHint",
+	// macOS convention, used by some cross platform password managers
+	"application/x-nspasteboard-concealed-type",
+	// Windows convention, offered by some apps running under XWayland
+	"ExcludeClipboardContentFromMonitorProcessing",
+}
+
+// sensitiveMime returns the first offered MIME type matching one of the
+// sensitive patterns.
+func (o Options) sensitiveMime(mimes []string) (string, bool) {
+	for _, pattern := range o.SensitiveMimes {
+		i := slices.IndexFunc(mimes, func(mime string) bool {
+			ok, _ := path.Match(pattern, mime)
+			return ok
+		})
+		if i != -1 {
+			return mimes[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,277 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/neurlang/wayland/wl"
+	"github.com/neurlang/wayland/wlclient"
+)
+
+// textMimes are offered alongside every text clip, so clients asking for
+// legacy X11 targets (e.g. through XWayland) still get the content.
+var textMimes = []string{
+	"text/plain;charset=utf-8",
+	"text/plain",
+	"UTF8_STRING",
+	"STRING",
+	"TEXT",
+}
+
+// persistMime is offered by selections persisted by the watcher, so that the
+// watcher doesn't record its own clips again.
+const persistMime = "application/x-yankd-persist"
+
+// source serves a clip for every mime type it offers
+type source struct {
+	proxy     dataSource
+	offers    map[string][]byte // mimeType -> data
+	mimes     []string          // offered mime types in order
+	writes    sync.WaitGroup
+	once      sync.Once
+	cancelled chan struct{}
+}
+
+// newSource creates a source offering clip under its own mime type first, then
+// every stored representation and compatible mime types. The order is kept so
+// that the watcher parses the clip back with the same mime type.
+func newSource(clip Clip) *source {
+	s := &source{
+		offers:    make(map[string][]byte),
+		cancelled: make(chan struct{}),
+	}
+
+	content := []byte(clip.Text)
+	if len(clip.Blob) != 0 {
+		content = clip.Blob
+	}
+	s.add(clip.Mime, content)
+
+	for _, rep := range clip.Representations {
+		if rep.Data != nil {
+			s.add(rep.Mime, rep.Data)
+		}
+	}
+
+	if len(clip.Blob) != 0 {
+		slog.Debug("offering binary content", "mime", clip.Mime)
+		return s
+	}
+
+	for _, mime := range textMimes {
+		s.add(mime, content)
+	}
+	slog.Debug("offering text content", "mime", clip.Mime)
+	return s
+}
+
+// add offers data under the mime type, unless the mime type is offered
+// already.
+func (s *source) add(mimeType string, data []byte) {
+	if _, ok := s.offers[mimeType]; ok {
+		return
+	}
+	s.offers[mimeType] = data
+	s.mimes = append(s.mimes, mimeType)
+}
+
+// handleSend writes the requested data to the given file descriptor.
+func (s *source) handleSend(mimeType string, fd uintptr, fdErr error) {
+	if fdErr != nil {
+		slog.Error("failed to receive fd", "mime", mimeType, "error", fdErr)
+		return
+	}
+
+	file := os.NewFile(fd, mimeType)
+	data, ok := s.offers[mimeType]
+	if !ok {
+		slog.Warn("requested mime type is not offered", "mime", mimeType)
+		file.Close()
+		return
+	}
+
+	// Writing may block until the receiver reads, so don't stall the event
+	// loop while doing it.
+	s.writes.Go(func() {
+		defer file.Close()
+		n, err := file.Write(data)
+		if err != nil {
+			slog.Error("failed to send data", "mime", mimeType, "error", err)
+			return
+		}
+		slog.Debug("data sent", "mime", mimeType, "size_bytes", n)
+	})
+}
+
+// handleCancelled handles the source being replaced by another selection.
+func (s *source) handleCancelled() {
+	slog.Debug("data source cancelled")
+	s.once.Do(func() {
+		s.destroy()
+		close(s.cancelled)
+	})
+}
+
+// destroy destroys the proxy of the source.
+func (s *source) destroy() {
+	if err := s.proxy.destroy(); err != nil {
+		slog.Debug("failed to destroy data source", "error", err)
+	}
+}
+
+// setSelection creates a source serving clip and sets it as the given selection
+// of the seat. A persisted source is marked with persistMime.
+func (s *seat) setSelection(
+	clip Clip,
+	selection Selection,
+	persist bool,
+) (*source, error) {
+	if selection == SelectionPrimary && !s.client.backend.primary() {
+		return nil, errNoPrimary
+	}
+
+	src := newSource(clip)
+	if persist {
+		src.add(persistMime, nil)
+	}
+
+	proxy, err := s.client.backend.createSource(src)
+	if err != nil {
+		slog.Error("failed to create data source", "error", err)
+		return nil, err
+	}
+	src.proxy = proxy
+
+	for _, mime := range src.mimes {
+		if err := proxy.offer(mime); err != nil {
+			slog.Error("failed to offer mime type", "mime", mime, "error", err)
+			src.destroy()
+			return nil, err
+		}
+	}
+
+	if selection == SelectionPrimary {
+		err = s.device.setPrimarySelection(proxy)
+	} else {
+		err = s.device.setSelection(proxy)
+	}
+	if err != nil {
+		slog.Error("failed to set selection", "selection", selection, "error", err)
+		src.destroy()
+		return nil, err
+	}
+
+	return src, nil
+}
+
+// Set sets clip as the given selection of the named seat and serves its content
+// until another client takes the selection or ctx is cancelled. Empty seat name
+// picks the first seat.
+func Set(
+	ctx context.Context,
+	clip Clip,
+	selection Selection,
+	seatName string,
+) error {
+	return SetReady(ctx, clip, selection, seatName, nil)
+}
+
+// SetReady is Set calling ready once the compositor has set the selection,
+// before serving its content. ready isn't called if setting the selection
+// fails.
+func SetReady(
+	ctx context.Context,
+	clip Clip,
+	selection Selection,
+	seatName string,
+	ready func(),
+) error {
+	slog.Info(
+		"setting clipboard",
+		"mime", clip.Mime,
+		"selection", selection,
+		"seat", seatName,
+	)
+
+	client := NewClient(nil, Options{})
+	defer client.Close()
+
+	if err := client.connect(); err != nil {
+		return err
+	}
+
+	s, err := client.findSeat(seatName)
+	if err != nil {
+		slog.Error("failed to find seat", "seat", seatName, "error", err)
+		return err
+	}
+
+	if err := s.getDevice(false); err != nil {
+		return err
+	}
+
+	src, err := s.setSelection(clip, selection, false)
+	if err != nil {
+		return err
+	}
+	defer src.writes.Wait()
+
+	if ready != nil {
+		if err := client.sync(); err != nil {
+			slog.Error("failed to sync with compositor", "error", err)
+			return fmt.Errorf("failed to sync with compositor: %w", err)
+		}
+		ready()
+	}
+	slog.Info("clipboard selection set, serving content")
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			slog.Info("context cancelled → attempting clean close")
+		case <-src.cancelled:
+		}
+		client.Close()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-src.cancelled:
+			slog.Info("clipboard selection replaced, stop serving")
+			return nil
+		default:
+			err := wlclient.DisplayDispatch(client.display)
+			// Offers of the device are not tracked, so events for them have
+			// no proxy.
+			if errors.Is(err, wl.ErrContextRunProxyNil) {
+				continue
+			}
+			if err != nil && !client.closed.Load() {
+				slog.Error("dispatch failed", "error", err)
+				return fmt.Errorf("dispatch failed: %w", err)
+			}
+		}
+	}
+}
+
+// sync waits until the compositor has processed the requests sent so far.
+func (h *Client) sync() error {
+	cb, err := h.display.Sync()
+	if err != nil {
+		return err
+	}
+	for {
+		err := h.display.Context().RunTill(cb)
+		// Offers of the device are not tracked, so events for them have no
+		// proxy.
+		if !errors.Is(err, wl.ErrContextRunProxyNil) {
+			return err
+		}
+	}
+}